@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// loadBaseline reads a baseline written by `baseline capture`: the values
+// of every domain on a clean install, keyed by domain.
+func loadBaseline(path string) (plist.Value, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := plist.DecodeJSON(data, plist.Options{})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := value.(plist.DictValue); !ok {
+		return nil, fmt.Errorf("expected an object keyed by domain")
+	}
+	return value, nil
+}
+
+// runBaseline implements `defaults2nix baseline capture`, which saves the
+// defaults of all domains as JSON for use with -baseline.
+func runBaseline(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env environment) int {
+	fs := flag.NewFlagSet("baseline", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: defaults2nix baseline capture [flags]\n\n")
+		fmt.Fprintf(stderr, "Save the defaults of all domains as JSON, to leave out the keys that still\n")
+		fmt.Fprintf(stderr, "have these values with -baseline. Run it on a clean install of macOS.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  defaults2nix baseline capture -out baseline.json\n")
+		fmt.Fprintf(stderr, "  defaults2nix baseline capture -i clean-install.txt -out baseline.json\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -baseline baseline.json -out ./configs/\n")
+	}
+	out := fs.String("out", "", "Output file path")
+	input := fs.String("i", "", "Read `file` holding `defaults read` output instead of running defaults, - for stdin")
+	if len(args) == 0 || args[0] != "capture" {
+		fs.Usage()
+		return 1
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 1
+	}
+
+	var output []byte
+	if *input != "" {
+		samples, err := readInputs([]string{*input}, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+			return 1
+		}
+		output = samples[0]
+	} else {
+		if env.goos != "darwin" {
+			fmt.Fprintf(stderr, "Error: Reading defaults requires macOS, use -i to capture a saved dump.\n")
+			return 1
+		}
+		var err error
+		output, err = env.source.Read(ctx, "")
+		if err != nil {
+			fmt.Fprintf(stderr, "Error executing 'defaults read': %v\n", err)
+			return 1
+		}
+	}
+
+	// The baseline keeps everything, filters apply when it is used
+	value, err := plist.Parse(bytes.NewReader(output), "", plist.Options{})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error converting defaults: %v\n", err)
+		return 1
+	}
+	if _, ok := value.(plist.DictValue); !ok {
+		fmt.Fprintf(stderr, "Error: Expected `defaults read` output for all domains.\n")
+		return 1
+	}
+	data, err := plist.EncodeJSON(value)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error encoding baseline: %v\n", err)
+		return 1
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		fmt.Fprintf(stderr, "Error encoding baseline: %v\n", err)
+		return 1
+	}
+	indented.WriteByte('\n')
+
+	if *out != "" {
+		if err := writeFileAtomic(*out, indented.Bytes(), 0644); err != nil {
+			fmt.Fprintf(stderr, "Error writing to file %s: %v\n", *out, err)
+			return 1
+		}
+		return 0
+	}
+	stdout.Write(indented.Bytes())
+	return 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestRunBaseline_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+	}{
+		{"Missing capture", nil, "Usage: defaults2nix baseline capture"},
+		{"Unknown action", []string{"apply"}, "Usage: defaults2nix baseline capture"},
+		{"Missing input", []string{"capture", "-i", filepath.Join(t.TempDir(), "missing.txt")}, "Error reading input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runBaseline(context.Background(), tt.args, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{})); code != 1 {
+				t.Errorf("runBaseline() = %d, want 1", code)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// runDiff implements `defaults2nix diff`. It compares the current defaults
+// of a domain with a Nix file generated earlier and exits with 0 when they
+// match, 1 when they drifted apart and 2 on errors.
+func runDiff(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env environment) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: defaults2nix diff [flags] <domain> <file.nix>\n\n")
+		fmt.Fprintf(stderr, "Compare the current defaults of a domain with a generated Nix file.\n")
+		fmt.Fprintf(stderr, "Lists keys added (+), removed (-) and changed (~) since the file was written,\n")
+		fmt.Fprintf(stderr, "and exits with 1 when there are any.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  defaults2nix diff com.apple.dock dock.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix diff -filter dates,state com.apple.finder finder.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix diff -i dock.txt com.apple.dock dock.nix\n")
+	}
+	conv := addConversionFlags(fs)
+	input := fs.String("i", "", "Read `file` holding `defaults read` output instead of running defaults, - for stdin")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+	domain, file := positional[0], positional[1]
+
+	config, queries, err := conv.parse(env.getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	existing, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", file, err)
+		return 2
+	}
+	declared, err := plist.ParseNix(string(existing))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error parsing %s: %v\n", file, err)
+		return 2
+	}
+
+	var output []byte
+	if *input != "" {
+		samples, err := readInputs([]string{*input}, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+			return 2
+		}
+		output = samples[0]
+	} else {
+		if env.goos != "darwin" {
+			fmt.Fprintf(stderr, "Error: Reading defaults requires macOS, use -i to compare a saved dump.\n")
+			return 2
+		}
+		output, err = env.source.Read(ctx, domain)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error executing 'defaults read %s': %v\n", domain, err)
+			return 2
+		}
+	}
+
+	converted, err := plist.ConvertDomain(strings.NewReader(string(output)), domain, config, queries)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error converting defaults: %v\n", err)
+		return 2
+	}
+	current, err := plist.Normalize(converted.Value, config)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error converting defaults: %v\n", err)
+		return 2
+	}
+
+	// Keys deleted from a merged file on purpose are not drift
+	meta, err := plist.ReadMergeMetadata(string(existing))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error parsing %s: %v\n", file, err)
+		return 2
+	}
+	var changes []plist.Change
+	for _, c := range plist.Diff(declared, current) {
+		if c.Kind == plist.ChangeAdded && meta.Ignores(c.Path) {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(stderr, "Info: No drift between %s and %s\n", domain, file)
+		return 0
+	}
+	for _, c := range changes {
+		fmt.Fprintln(stdout, plist.FormatChange(domain, c))
+	}
+	return 1
+}
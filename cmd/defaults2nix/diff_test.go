@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "dock.txt")
+	if err := os.WriteFile(dump, []byte(`{
+    autohide = 1;
+    "autohide-delay" = "0.2";
+    "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+    tilesize = 64;
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		args     []string
+		code     int
+		expected string
+	}{
+		{
+			"No drift",
+			"{\n  autohide = true;\n  \"autohide-delay\" = 0.2;\n  tilesize = 64;\n}",
+			[]string{"-filter", "state"},
+			0,
+			"",
+		},
+		{
+			"Drift",
+			"# Dock\n{\n  autohide = false;\n  orientation = \"left\";\n  tilesize = 64;\n}",
+			[]string{"-filter", "state"},
+			1,
+			"~ com.apple.dock:autohide = false -> true\n- com.apple.dock:orientation = \"left\"\n+ com.apple.dock:autohide-delay = 0.2\n",
+		},
+		{
+			"Ignored keys are not drift",
+			"{\n  autohide = true;\n  tilesize = 64;\n}\n# defaults2nix-ignore: autohide-delay\n# defaults2nix-ignore: NSWindow*\n",
+			nil,
+			0,
+			"",
+		},
+		{
+			"Unfiltered keys count as added",
+			"{\n  autohide = true;\n  \"autohide-delay\" = 0.2;\n  tilesize = 64;\n}",
+			nil,
+			1,
+			"+ com.apple.dock:NSWindow Frame Main = \"0 0 800 600 0 0 1440 900 \"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, "dock.nix")
+			if err := os.WriteFile(file, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			args := append(append([]string{"-i", dump}, tt.args...), "com.apple.dock", file)
+			code := runDiff(context.Background(), args, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{}))
+			if code != tt.code {
+				t.Errorf("runDiff() = %d, want %d (stderr: %s)", code, tt.code, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("runDiff() output =\n%s\nwant\n%s", stdout.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunDiff_Errors(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "broken.nix")
+	if err := os.WriteFile(file, []byte("{ a = 1 }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+	}{
+		{"Missing arguments", []string{"com.apple.dock"}, "Usage: defaults2nix diff"},
+		{"Missing file", []string{"-i", file, "com.apple.dock", filepath.Join(dir, "missing.nix")}, "Error reading"},
+		{"Invalid Nix", []string{"-i", file, "com.apple.dock", file}, "Error parsing"},
+		{"Unknown filter", []string{"-filter", "bogus", "com.apple.dock", file}, "Unknown filter option"},
+		{"Unknown format", []string{"-format", "bogus", "com.apple.dock", file}, "Error: Unknown format option 'bogus'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runDiff(context.Background(), tt.args, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{})); code != 2 {
+				t.Errorf("runDiff() = %d, want 2", code)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// readHostDump reads the JSON dump of a host, written by `baseline
+// capture`, and converts it like `defaults read` output for all domains.
+func readHostDump(path string, config plist.Options, queries []plist.SelectQuery) (plist.Value, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := plist.DecodeJSON(data, config)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := value.(plist.DictValue); !ok {
+		return nil, fmt.Errorf("expected an object keyed by domain")
+	}
+	converted, err := plist.ConvertValues([]plist.Value{value}, "", config, queries)
+	if err != nil {
+		return nil, err
+	}
+	return plist.Normalize(converted.Value, config)
+}
+
+// countSettings returns the number of key paths set in value.
+func countSettings(value plist.Value) int {
+	if dict, ok := value.(plist.DictValue); ok && len(dict.Values) == 0 {
+		return 0
+	}
+	return len(plist.LeafPaths(value, nil))
+}
+
+// hostName returns the name of the host a dump belongs to: its file name
+// without the extension.
+func hostName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// runMergeHosts implements `defaults2nix merge-hosts`. It reads the dumps
+// of several hosts and writes the settings they share to common.nix and
+// the deviations of each host to hosts/<name>.nix.
+func runMergeHosts(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env environment) int {
+	fs := flag.NewFlagSet("merge-hosts", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: defaults2nix merge-hosts [flags] <host.json>...\n\n")
+		fmt.Fprintf(stderr, "Split the settings of several hosts, dumped with `baseline capture`, into\n")
+		fmt.Fprintf(stderr, "common.nix with the settings they agree on and hosts/<name>.nix with the\n")
+		fmt.Fprintf(stderr, "deviations of each host. The host name is the file name of its dump.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  defaults2nix merge-hosts -out ./macs/ dumps/*.json\n")
+		fmt.Fprintf(stderr, "  defaults2nix merge-hosts -quorum 30 -filter dates,state,usage -out ./macs/ dumps/*.json\n")
+	}
+	conv := addConversionFlags(fs)
+	out := fs.String("out", "", "Output directory path")
+	quorum := fs.Int("quorum", 0, "Number of hosts that must share a value for it to go into common.nix (default all hosts)")
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(paths) < 2 {
+		fs.Usage()
+		return 1
+	}
+	if *out == "" {
+		fmt.Fprintf(stderr, "Error: -out is mandatory for merge-hosts.\n")
+		return 1
+	}
+	if *quorum == 0 {
+		*quorum = len(paths)
+	}
+	if *quorum < 1 || *quorum > len(paths) {
+		fmt.Fprintf(stderr, "Error: -quorum must be between 1 and the number of hosts (%d).\n", len(paths))
+		return 1
+	}
+
+	config, queries, err := conv.parse(env.getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var names []string
+	var hosts []plist.Value
+	seen := make(map[string]string)
+	for _, path := range paths {
+		name := hostName(path)
+		if previous, ok := seen[sanitizeFilename(name)]; ok {
+			fmt.Fprintf(stderr, "Error: %s and %s would both be written to hosts/%s.nix.\n", previous, path, sanitizeFilename(name))
+			return 1
+		}
+		seen[sanitizeFilename(name)] = path
+
+		host, err := readHostDump(path, config, queries)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading %s: %v\n", path, err)
+			return 1
+		}
+		names = append(names, name)
+		hosts = append(hosts, host)
+	}
+
+	split := plist.SplitHosts(hosts, *quorum)
+
+	if err := os.MkdirAll(filepath.Join(*out, "hosts"), 0755); err != nil {
+		fmt.Fprintf(stderr, "Error creating output directory %s: %v\n", *out, err)
+		return 1
+	}
+	files := []string{filepath.Join(*out, "common.nix")}
+	values := []plist.Value{split.Common}
+	for i, name := range names {
+		files = append(files, filepath.Join(*out, "hosts", sanitizeFilename(name)+".nix"))
+		values = append(values, split.Hosts[i])
+	}
+	for i, file := range files {
+		if err := writeFileAtomic(file, []byte(renderNix(values[i], config)), 0644); err != nil {
+			fmt.Fprintf(stderr, "Error writing to file %s: %v\n", file, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(stderr, "Info: %d settings shared by at least %d of %d hosts written to %s\n", countSettings(split.Common), *quorum, len(hosts), files[0])
+	for i, name := range names {
+		fmt.Fprintf(stderr, "Info: %d settings specific to %s written to %s\n", countSettings(split.Hosts[i]), name, files[i+1])
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestRunMergeHosts(t *testing.T) {
+	dir := t.TempDir()
+	dumps := map[string]string{
+		"studio.json":  `{"com.apple.dock":{"autohide":true,"tilesize":48,"LaunchCount":12},"NSGlobalDomain":{"AppleLocale":"en_US"}}`,
+		"laptop.json":  `{"com.apple.dock":{"autohide":true,"tilesize":36,"LaunchCount":40},"NSGlobalDomain":{"AppleLocale":"en_US"}}`,
+		"kiosk-1.json": `{"com.apple.dock":{"autohide":false,"tilesize":48,"LaunchCount":3}}`,
+	}
+	var paths []string
+	for _, name := range []string{"studio.json", "laptop.json", "kiosk-1.json"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(dumps[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	out := filepath.Join(dir, "macs")
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-quorum", "2", "-filter", "usage", "-out", out}, paths...)
+	if code := runMergeHosts(context.Background(), args, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{})); code != 0 {
+		t.Fatalf("runMergeHosts() = %d, stderr: %s", code, stderr.String())
+	}
+
+	expected := map[string]string{
+		"common.nix":        "{\n  \"com.apple.dock\" = {\n    autohide = true;\n    tilesize = 48;\n  };\n  NSGlobalDomain = {\n    AppleLocale = \"en_US\";\n  };\n}",
+		"hosts/studio.nix":  "{}",
+		"hosts/laptop.nix":  "{\n  \"com.apple.dock\" = {\n    tilesize = 36;\n  };\n}",
+		"hosts/kiosk-1.nix": "{\n  \"com.apple.dock\" = {\n    autohide = false;\n  };\n}",
+	}
+	for file, content := range expected {
+		data, err := os.ReadFile(filepath.Join(out, file))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", file, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s =\n%s\nwant\n%s", file, data, content)
+		}
+	}
+	if !strings.Contains(stderr.String(), "Info: 3 settings shared by at least 2 of 3 hosts") {
+		t.Errorf("Expected summary on stderr, got: %s", stderr.String())
+	}
+}
+
+func TestRunMergeHosts_Errors(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.json")
+	if err := os.WriteFile(a, []byte(`{"com.apple.dock":{}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte(`["com.apple.dock"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+	}{
+		{"Single host", []string{"-out", dir, a}, "Usage: defaults2nix merge-hosts"},
+		{"Missing output", []string{a, a}, "-out is mandatory"},
+		{"Quorum too large", []string{"-quorum", "3", "-out", dir, a, broken}, "-quorum must be between 1 and the number of hosts (2)"},
+		{"Same host twice", []string{"-out", dir, a, a}, "would both be written to hosts/a.nix"},
+		{"Not keyed by domain", []string{"-out", dir, a, broken}, "Error reading " + broken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runMergeHosts(context.Background(), tt.args, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{})); code != 1 {
+				t.Errorf("runMergeHosts() = %d, want 1", code)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
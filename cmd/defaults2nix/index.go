@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// indexName is the file -split writes next to the domain files, importing
+// all of them.
+const indexName = "default.nix"
+
+// indexFile is the index written by a -split run.
+type indexFile struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// nixPathLiteral matches relative paths that can be written as Nix path
+// literals.
+var nixPathLiteral = regexp.MustCompile(`^[A-Za-z0-9._+/-]+$`)
+
+// renderIndex returns the contents of the index of the output directory
+// dir, which imports the file of every domain in m under its domain, in the
+// shape format expects. Files kept from earlier runs or left alone by the
+// overwrite policy are imported as long as they exist. Files that are
+// functions are called with the arguments they need. It returns false when
+// there is nothing to import.
+func renderIndex(dir string, m manifest, format plist.Format) (string, bool) {
+	args := "{ inherit home; }"
+	if format == plist.FormatDarwin || format == plist.FormatHomeManager {
+		args = "{ inherit config; }"
+	}
+
+	var lines []string
+	needsArgs := false
+	for _, e := range m.Domains {
+		if e.File == "" || !filepath.IsLocal(e.File) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.File))
+		if err != nil {
+			continue
+		}
+		line := fmt.Sprintf("%s = import %s", plist.NixAttrPath([]string{e.Domain}), nixRelativePath(e.File))
+		if plist.HasFunctionHeader(string(data)) {
+			line += " " + args
+			needsArgs = true
+		}
+		lines = append(lines, line+";")
+	}
+	if len(lines) == 0 {
+		return "", false
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Generated by defaults2nix -split, imports every domain file in this directory\n")
+	switch format {
+	case plist.FormatDarwin, plist.FormatHomeManager:
+		option := "system.defaults.CustomUserPreferences"
+		if format == plist.FormatHomeManager {
+			option = "targets.darwin.defaults"
+		}
+		sb.WriteString("{ config, ... }:\n{\n  " + option + " = {\n")
+		for _, line := range lines {
+			sb.WriteString("    " + line + "\n")
+		}
+		sb.WriteString("  };\n}\n")
+	default:
+		if needsArgs {
+			sb.WriteString("{ home }:\n")
+		}
+		sb.WriteString("{\n")
+		for _, line := range lines {
+			sb.WriteString("  " + line + "\n")
+		}
+		sb.WriteString("}\n")
+	}
+	return sb.String(), true
+}
+
+// nixRelativePath returns a Nix expression for the path of file relative
+// to the Nix file in the same directory.
+func nixRelativePath(file string) string {
+	file = filepath.ToSlash(file)
+	if nixPathLiteral.MatchString(file) {
+		return "./" + file
+	}
+	return fmt.Sprintf("(./. + \"/%s\")", strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`).Replace(file))
+}
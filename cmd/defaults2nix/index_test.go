@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestRenderIndex(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"NSGlobalDomain.nix":   "{\n  AppleLocale = \"en_US\";\n}",
+		"com-apple-finder.nix": "{ home }:\n{\n  NewWindowTargetPath = \"${home}/Downloads\";\n}",
+		// Hand-written functions are called too, whatever their header
+		"com-example-app.nix": "\nargs:\n{\n  level = 1;\n}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := manifest{Domains: []manifestEntry{
+		{Domain: "NSGlobalDomain", Status: statusWritten, File: "NSGlobalDomain.nix", SHA256: "a"},
+		{Domain: "com.apple.finder", Status: statusUnchanged, File: "com-apple-finder.nix", SHA256: "b"},
+		{Domain: "com.apple.empty", Status: statusEmpty},
+		// Files left alone by the overwrite policy are still imported
+		{Domain: "com.example.app", Status: statusKept, File: "com-example-app.nix"},
+		// Files that are gone aren't
+		{Domain: "com.example.gone", Status: statusReadError, File: "com-example-gone.nix", SHA256: "c"},
+	}}
+
+	tests := []struct {
+		format   plist.Format
+		expected string
+	}{
+		{plist.FormatPlain, `# Generated by defaults2nix -split, imports every domain file in this directory
+{ home }:
+{
+  NSGlobalDomain = import ./NSGlobalDomain.nix;
+  "com.apple.finder" = import ./com-apple-finder.nix { inherit home; };
+  "com.example.app" = import ./com-example-app.nix { inherit home; };
+}
+`},
+		{plist.FormatDarwin, `# Generated by defaults2nix -split, imports every domain file in this directory
+{ config, ... }:
+{
+  system.defaults.CustomUserPreferences = {
+    NSGlobalDomain = import ./NSGlobalDomain.nix;
+    "com.apple.finder" = import ./com-apple-finder.nix { inherit config; };
+    "com.example.app" = import ./com-example-app.nix { inherit config; };
+  };
+}
+`},
+		{plist.FormatHomeManager, `# Generated by defaults2nix -split, imports every domain file in this directory
+{ config, ... }:
+{
+  targets.darwin.defaults = {
+    NSGlobalDomain = import ./NSGlobalDomain.nix;
+    "com.apple.finder" = import ./com-apple-finder.nix { inherit config; };
+    "com.example.app" = import ./com-example-app.nix { inherit config; };
+  };
+}
+`},
+	}
+	for _, tt := range tests {
+		index, ok := renderIndex(dir, m, tt.format)
+		if !ok || index != tt.expected {
+			t.Errorf("renderIndex(%s) =\n%s\nwant:\n%s", tt.format, index, tt.expected)
+		}
+	}
+
+	if _, ok := renderIndex(dir, manifest{}, plist.FormatPlain); ok {
+		t.Error("Expected no index without files to import")
+	}
+}
+
+func TestNixRelativePath(t *testing.T) {
+	tests := map[string]string{
+		"com-apple-Safari.nix":        "./com-apple-Safari.nix",
+		filepath.Join("com", "a.nix"): "./com/a.nix",
+		"com.example.a~b.nix":         `(./. + "/com.example.a~b.nix")`,
+		`com.example.${x}.nix`:        `(./. + "/com.example.\${x}.nix")`,
+	}
+	for file, expected := range tests {
+		if got := nixRelativePath(file); got != expected {
+			t.Errorf("nixRelativePath(%s) = %s, want %s", file, got, expected)
+		}
+	}
+}
+
+func TestSplitMode_Index(t *testing.T) {
+	outputDir := t.TempDir()
+	indexPath := filepath.Join(outputDir, indexName)
+	split := func(source plist.MemorySource, args ...string) string {
+		t.Helper()
+		exitCode, _, stderr := runCLI(testEnv(source), append([]string{"-split", "-out", outputDir}, args...)...)
+		if exitCode != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+		}
+		return stderr
+	}
+
+	split(cliDomains, "-naming", "nested")
+	index, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Generated by defaults2nix -split, imports every domain file in this directory
+{
+  "com.apple.Safari" = import ./com/apple/Safari.nix;
+  "com.apple.dock" = import ./com/apple/dock.nix;
+}
+`
+	if string(index) != expected {
+		t.Errorf("Expected index:\n%s\ngot:\n%s", expected, index)
+	}
+
+	// Pruned domains drop out of the index
+	split(plist.MemorySource{"com.apple.dock": cliDomains["com.apple.dock"]}, "-naming", "nested", "-prune")
+	index, err = os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), "Safari") || !strings.Contains(string(index), `"com.apple.dock" = import ./com/apple/dock.nix;`) {
+		t.Errorf("Expected only com.apple.dock in the index, got:\n%s", index)
+	}
+
+	// Without any files, the index is stale too
+	_, _, stderr := runCLI(testEnv(plist.MemorySource{"com.example.empty": "{\n}"}), "-split", "-prune", "-out", outputDir)
+	if !strings.Contains(stderr, "Info: Removed 2 stale files: com/apple/dock.nix, default.nix") {
+		t.Errorf("Expected the index to be pruned, got: %s", stderr)
+	}
+	if _, err := os.Stat(indexPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the index to be removed, got %v", err)
+	}
+
+	// A domain can't take the place of the index
+	source := plist.MemorySource{"Default": "{\n    a = 1;\n}", "com.apple.dock": cliDomains["com.apple.dock"]}
+	exitCode, _, stderr := runCLI(testEnv(source), "-split", "-out", t.TempDir())
+	if exitCode != 1 || !strings.Contains(stderr, "Error: Domain Default would be written to default.nix, which imports the other files, so it isn't.") {
+		t.Errorf("Expected the domain to be rejected, got exit code %d: %s", exitCode, stderr)
+	}
+}
@@ -0,0 +1,973 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// readSamples calls read n times, waiting interval between calls. It stops
+// early when ctx is done.
+func readSamples(ctx context.Context, read func(context.Context) ([]byte, error), n int, interval time.Duration) ([][]byte, error) {
+	var samples [][]byte
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if err := sleep(ctx, interval); err != nil {
+				return nil, err
+			}
+		}
+		output, err := read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, output)
+	}
+	return samples, nil
+}
+
+// sleep waits for d to pass, or returns the error of ctx when it's done
+// first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errReadTimeout is returned by readDomain when a read takes longer than
+// its timeout.
+var errReadTimeout = errors.New("timed out")
+
+// readDomain reads domain from source, giving up after timeout unless it is
+// zero. A read that is stopped because ctx is done returns the error of
+// ctx, so that it can be told apart from a domain that failed to read.
+func readDomain(ctx context.Context, source plist.DefaultsSource, domain string, timeout time.Duration) ([]byte, error) {
+	readCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	output, err := source.Read(readCtx, domain)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if readCtx.Err() != nil {
+			return nil, fmt.Errorf("%w after %s", errReadTimeout, timeout)
+		}
+	}
+	return output, err
+}
+
+// readInputs reads the files given with -i, where "-" is standard input.
+func readInputs(paths []string, stdin io.Reader) ([][]byte, error) {
+	var samples [][]byte
+	for _, path := range paths {
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, data)
+	}
+	return samples, nil
+}
+
+func extractBundleIDs(value plist.Value) map[string]plist.Value {
+	bundleMap := make(map[string]plist.Value)
+
+	if dict, ok := value.(plist.DictValue); ok {
+		for key, val := range dict.Values {
+			// Skip binary data values
+			if _, isSkip := val.(plist.SkipValue); isSkip {
+				continue
+			}
+			// Include all top-level keys - bundle IDs, NSGlobalDomain, and custom preferences
+			bundleMap[key] = val
+		}
+	}
+
+	return bundleMap
+}
+
+func sanitizeFilename(key string) string {
+	// Remove quotes if present
+	filename := strings.Trim(key, "\"")
+	// Replace dots with hyphens for filename safety
+	filename = strings.ReplaceAll(filename, ".", "-")
+	// Replace any other problematic characters
+	filename = strings.ReplaceAll(filename, " ", "_")
+	filename = strings.ReplaceAll(filename, "/", "_")
+	return filename
+}
+
+// reportRedacted lists the key paths removed by the secrets filter, so that
+// the generated files can be reviewed before they are committed.
+func reportRedacted(w io.Writer, paths []string, dropped bool) {
+	if len(paths) == 0 {
+		return
+	}
+	action := "Redacted"
+	if dropped {
+		action = "Dropped"
+	}
+	fmt.Fprintf(w, "Info: %s %d secret values: %s\n", action, len(paths), strings.Join(paths, ", "))
+}
+
+// reportVolatile lists the key paths whose value changed between samples.
+func reportVolatile(w io.Writer, paths []string, dropped bool) {
+	if len(paths) == 0 {
+		return
+	}
+	action := "Annotated"
+	if dropped {
+		action = "Dropped"
+	}
+	fmt.Fprintf(w, "Info: %s %d volatile keys: %s\n", action, len(paths), strings.Join(paths, ", "))
+}
+
+// renderNix renders value as the contents of a Nix file.
+func renderNix(value plist.Value, config plist.Options) string {
+	var sb strings.Builder
+	plist.Render(&sb, value, config.Format)
+	return sb.String()
+}
+
+// renderFile renders value as the contents of a Nix file written by -out or
+// -split, recording its keys so that a later -merge leaves out the keys
+// deleted from it.
+func renderFile(value plist.Value, config plist.Options) string {
+	nix := renderNix(value, config)
+	if marked, err := plist.MarkKnown(nix); err == nil {
+		return marked
+	}
+	return nix
+}
+
+// reportUnfinished prints the domains -split didn't get to because it was
+// interrupted or ran out of time, as told by err.
+func reportUnfinished(w io.Writer, err error, deadline time.Duration, domains []string) {
+	if len(domains) == 0 {
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(w, "Warning: Deadline of %s reached before %d domains were processed: %s\n", deadline, len(domains), strings.Join(domains, ", "))
+	} else {
+		fmt.Fprintf(w, "Warning: Interrupted before %d domains were processed: %s\n", len(domains), strings.Join(domains, ", "))
+	}
+}
+
+// reportKept prints the existing files -split didn't overwrite.
+func reportKept(w io.Writer, files []string, noClobber bool) {
+	if len(files) == 0 {
+		return
+	}
+	if noClobber {
+		fmt.Fprintf(w, "Info: Left %d existing files alone because of -no-clobber: %s\n", len(files), strings.Join(files, ", "))
+	} else {
+		fmt.Fprintf(w, "Warning: Left %d existing files alone that defaults2nix didn't write or that were edited, use -force to overwrite them: %s\n", len(files), strings.Join(files, ", "))
+	}
+}
+
+// reportStale prints the files -prune removed, or the stale files it
+// would remove.
+func reportStale(w io.Writer, pruned []string, stale []staleFile) {
+	if len(pruned) > 0 {
+		fmt.Fprintf(w, "Info: Removed %d stale files: %s\n", len(pruned), strings.Join(pruned, ", "))
+	}
+	if len(stale) > 0 {
+		files := make([]string, len(stale))
+		for i, f := range stale {
+			files[i] = f.File
+		}
+		fmt.Fprintf(w, "Info: %d files belong to domains that are gone or empty, remove them with -prune: %s\n", len(stale), strings.Join(files, ", "))
+	}
+}
+
+// writeMerge merges value into the file at path and writes the result to
+// out, or back to path when out is empty. It returns the exit code.
+func writeMerge(stderr io.Writer, path, out string, value plist.Value, domain string, config plist.Options) int {
+	result, err := mergeFile(path, value, domain, config)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error merging into %s: %v\n", path, err)
+		return 1
+	}
+	reportMerge(stderr, path, result)
+	if out == "" {
+		out = path
+	}
+	if err := writeFileAtomic(out, []byte(result.Output), 0644); err != nil {
+		fmt.Fprintf(stderr, "Error writing to file %s: %v\n", out, err)
+		return 1
+	}
+	return 0
+}
+
+// conversionFlags are the flags controlling how defaults are converted,
+// shared by the main command and the subcommands.
+type conversionFlags struct {
+	filter         *string
+	redact         *string
+	format         *string
+	templatizeHome *bool
+	home           *string
+	baseline       *string
+	selects        stringList
+}
+
+func addConversionFlags(fs *flag.FlagSet) *conversionFlags {
+	f := &conversionFlags{}
+	f.filter = fs.String("filter", "", "Comma-separated list of items to filter out (dates,state,uuids,secrets,usage,recents,versions)")
+	f.redact = fs.String("redact", "placeholder", "How to handle values matched by -filter secrets (placeholder, drop)")
+	f.format = fs.String("format", "plain", "Nix configuration the output is written for (plain, darwin, home-manager)")
+	f.templatizeHome = fs.Bool("templatize-home", false, "Rewrite paths below the home directory as Nix expressions")
+	f.home = fs.String("home", "", "Home directory to templatize (default $HOME)")
+	f.baseline = fs.String("baseline", "", "Leave out keys whose value equals the one in this `file`, written by `baseline capture`")
+	fs.Var(&f.selects, "select", "Key path to keep, e.g. `domain:key.child` or 'NSGlobalDomain:Apple*' (repeatable)")
+	return f
+}
+
+// parse validates the flags and returns the parse configuration and
+// selection queries they describe.
+func (f *conversionFlags) parse(getenv func(string) string) (plist.Options, []plist.SelectQuery, error) {
+	var filters []plist.Filter
+	if *f.filter != "" {
+		for _, name := range strings.Split(*f.filter, ",") {
+			filter, err := plist.ParseFilter(name)
+			if err != nil {
+				return plist.Options{}, nil, err
+			}
+			filters = append(filters, filter)
+		}
+	}
+	config := plist.NewOptions(filters...)
+
+	switch *f.redact {
+	case "placeholder":
+	case "drop":
+		config.DropSecrets = true
+	default:
+		return config, nil, fmt.Errorf("Unknown redact option '%s'. Valid options are: placeholder, drop", *f.redact)
+	}
+
+	outputFormat, err := plist.ParseFormat(*f.format)
+	if err != nil {
+		return config, nil, err
+	}
+	config.Format = outputFormat
+	if *f.templatizeHome {
+		homeDir := *f.home
+		if homeDir == "" {
+			homeDir = getenv("HOME")
+		}
+		if homeDir == "" || homeDir == "/" {
+			return config, nil, fmt.Errorf("Cannot determine the home directory to templatize, use -home.")
+		}
+		config.Home = plist.NewHomeTemplate(homeDir, outputFormat)
+	}
+	if *f.baseline != "" {
+		baseline, err := loadBaseline(*f.baseline)
+		if err != nil {
+			return config, nil, fmt.Errorf("Cannot read baseline %s: %v", *f.baseline, err)
+		}
+		config.Baseline = baseline
+	}
+
+	var queries []plist.SelectQuery
+	for _, s := range f.selects {
+		queries = append(queries, plist.ParseSelectQuery(s))
+	}
+	return config, queries, nil
+}
+
+// filterNames returns the names of the filters given with -filter.
+func (f *conversionFlags) filterNames() []string {
+	names := []string{}
+	if *f.filter != "" {
+		for _, name := range strings.Split(*f.filter, ",") {
+			names = append(names, strings.TrimSpace(strings.ToLower(name)))
+		}
+	}
+	return names
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// checkPlatform reports whether defaults can be read on this platform,
+// explaining why not on stderr.
+func checkPlatform(stderr io.Writer, env environment) bool {
+	if env.goos == "darwin" {
+		return true
+	}
+	fmt.Fprintf(stderr, "Error: defaults2nix is designed for macOS only (requires 'defaults' command).\n")
+	fmt.Fprintf(stderr, "Current platform: %s\n", env.goos)
+	fmt.Fprintf(stderr, "Use -i to convert saved `defaults read` output.\n")
+	return false
+}
+
+// parseInterspersed parses the flags in args like fs.Parse, but also those
+// that follow an argument, as in `defaults2nix com.apple.dock -o dock.nix`.
+// It returns the arguments. Everything after "--" is an argument.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// environment is what run takes from the process it runs in, so that tests
+// can run the CLI on any platform without a Mac.
+type environment struct {
+	goos   string               // Platform, checked before running defaults
+	getenv func(string) string  // Looks up environment variables such as HOME
+	source plist.DefaultsSource // Reads the defaults, runs the defaults command
+}
+
+func main() {
+	env := environment{goos: runtime.GOOS, getenv: os.Getenv, source: plist.CommandSource{}}
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr, env))
+}
+
+// run runs the command line args, without the program name, and returns the
+// exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env environment) int {
+	// Subcommands check the platform themselves, since they can also work on
+	// saved `defaults read` output
+	if len(args) > 0 {
+		switch args[0] {
+		case "diff":
+			return runDiff(ctx, args[1:], stdin, stdout, stderr, env)
+		case "record":
+			return runRecord(ctx, args[1:], stdin, stdout, stderr, env)
+		case "baseline":
+			return runBaseline(ctx, args[1:], stdin, stdout, stderr, env)
+		case "merge-hosts":
+			return runMergeHosts(ctx, args[1:], stdin, stdout, stderr, env)
+		}
+	}
+
+	if len(args) > 0 && args[0] == "watch" {
+		if !checkPlatform(stderr, env) {
+			return 1
+		}
+		return runWatch(ctx, args[1:], stdin, stdout, stderr, env)
+	}
+
+	fs := flag.NewFlagSet("defaults2nix", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: defaults2nix [flags] [domain...]\n")
+		fmt.Fprintf(stderr, "       defaults2nix diff [flags] <domain> <file.nix>\n")
+		fmt.Fprintf(stderr, "       defaults2nix record [flags]\n")
+		fmt.Fprintf(stderr, "       defaults2nix watch [flags] [domains...]\n")
+		fmt.Fprintf(stderr, "       defaults2nix baseline capture [flags]\n")
+		fmt.Fprintf(stderr, "       defaults2nix merge-hosts [flags] <host.json>...\n\n")
+		fmt.Fprintf(stderr, "A tool for converting macOS defaults into Nix templates.\n\n")
+		fmt.Fprintf(stderr, "Commands:\n")
+		fmt.Fprintf(stderr, "  diff\n")
+		fmt.Fprintf(stderr, "	Compare current defaults with a generated Nix file, exit 1 on drift.\n")
+		fmt.Fprintf(stderr, "  record\n")
+		fmt.Fprintf(stderr, "	Print the keys that change while you change a setting.\n")
+		fmt.Fprintf(stderr, "  watch\n")
+		fmt.Fprintf(stderr, "	Print every key that changes as a Nix assignment, until interrupted.\n")
+		fmt.Fprintf(stderr, "  baseline capture\n")
+		fmt.Fprintf(stderr, "	Save the defaults of all domains as JSON, for use with -baseline.\n")
+		fmt.Fprintf(stderr, "  merge-hosts\n")
+		fmt.Fprintf(stderr, "	Split the dumps of several hosts into shared and host specific settings.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nArguments:\n")
+		fmt.Fprintf(stderr, "  domain\n")
+		fmt.Fprintf(stderr, "	The domain to convert (e.g., com.apple.dock). Several domains are\n")
+		fmt.Fprintf(stderr, "	converted into one attrset keyed by domain, or into a file each with -split.\n")
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  defaults2nix com.apple.Safari\n")
+		fmt.Fprintf(stderr, "  defaults2nix -o safari.nix com.apple.Safari\n")
+		fmt.Fprintf(stderr, "  defaults2nix -o ui.nix com.apple.dock com.apple.finder NSGlobalDomain\n")
+		fmt.Fprintf(stderr, "  defaults2nix -all -o all-defaults.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix -all -filter dates -o all-defaults.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix -all -filter state,uuids -o all-defaults.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix -all -filter dates,state,uuids -o all-defaults.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix -all -filter secrets -redact drop -o all-defaults.nix\n")
+		fmt.Fprintf(stderr, "  defaults2nix -templatize-home -format home-manager com.apple.finder\n")
+		fmt.Fprintf(stderr, "  defaults2nix -sample 3 -interval 10s -volatile drop com.apple.dock\n")
+		fmt.Fprintf(stderr, "  defaults2nix -i before.txt -i after.txt com.apple.dock\n")
+		fmt.Fprintf(stderr, "  defaults2nix -filter state -merge dock.nix com.apple.dock\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -o ./configs/ com.apple.dock com.apple.finder\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -baseline baseline.json -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -jobs 8 -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -prune -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -no-clobber -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -naming nested -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -split -timeout 10s -deadline 5m -o ./configs/\n")
+		fmt.Fprintf(stderr, "  defaults2nix -select persistent-apps com.apple.dock\n")
+		fmt.Fprintf(stderr, "  defaults2nix -all -select 'NSGlobalDomain:Apple*' -select com.apple.dock:autohide\n")
+		fmt.Fprintf(stderr, "  sudo defaults2nix -all -o all-defaults.nix  # for system configs\n")
+	}
+
+	all := fs.Bool("all", false, "Process all defaults from `defaults read`")
+	conv := addConversionFlags(fs)
+	split := fs.Bool("split", false, "Split defaults into individual Nix files by domain")
+	out := fs.String("out", "", "Output file or directory path")
+	fs.StringVar(out, "o", "", "Shorthand for -out")
+	sample := fs.Int("sample", 1, "Read each domain this many times and mark keys that change as volatile")
+	interval := fs.Duration("interval", 2*time.Second, "Time to wait between samples")
+	namingFlag := fs.String("naming", "hyphens", "How -split names files: hyphens (com-apple-Safari.nix), dots (com.apple.Safari.nix) or nested (com/apple/Safari.nix)")
+	noClobber := fs.Bool("no-clobber", false, "Never overwrite existing output files, including the -out file")
+	force := fs.Bool("force", false, "With -split, also overwrite files that defaults2nix didn't write or that were edited")
+	prune := fs.Bool("prune", false, "With -split, remove the files of an earlier run whose domain is gone or empty")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Number of domains to read and convert at the same time")
+	timeout := fs.Duration("timeout", 30*time.Second, "Give up reading a domain after this long, 0 for no limit")
+	deadline := fs.Duration("deadline", 0, "Stop reading defaults after this long in total, 0 for no limit")
+	volatile := fs.String("volatile", "comment", "How to handle keys that changed between samples (comment, drop)")
+	merge := fs.String("merge", "", "Merge into this previously generated `file`, keeping hand edits (written back unless -out is given)")
+	var inputs stringList
+	fs.Var(&inputs, "i", "Read `file` holding `defaults read` output instead of running defaults, - for stdin (repeat to compare snapshots)")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	// Saved `defaults read` output can be converted anywhere
+	if len(inputs) == 0 && !checkPlatform(stderr, env) {
+		return 1
+	}
+
+	config, queries, err := conv.parse(env.getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch *volatile {
+	case "comment":
+	case "drop":
+		config.DropVolatile = true
+	default:
+		fmt.Fprintf(stderr, "Error: Unknown volatile option '%s'. Valid options are: comment, drop\n", *volatile)
+		return 1
+	}
+
+	naming, err := parseNaming(*namingFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Every domain is read once, in the order given. An empty domain would
+	// read all domains.
+	var domainArgs []string
+	for _, domain := range positional {
+		if domain == "" {
+			fmt.Fprintf(stderr, "Error: Domain names must not be empty.\n")
+			return 1
+		}
+		if !slices.Contains(domainArgs, domain) {
+			domainArgs = append(domainArgs, domain)
+		}
+	}
+
+	// No flags and no args, show usage
+	if !*all && !*split && *out == "" && len(domainArgs) == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	// Prevent using -all with domain arguments
+	if *all && len(domainArgs) > 0 {
+		fmt.Fprintf(stderr, "Error: Cannot use -all with a domain argument.\n")
+		fs.Usage()
+		return 1
+	}
+
+	// Prevent using -all and -split together
+	if *all && *split {
+		fmt.Fprintf(stderr, "Error: Cannot use -all and -split at the same time.\n")
+		fs.Usage()
+		return 1
+	}
+
+	if *sample < 1 {
+		fmt.Fprintf(stderr, "Error: -sample must be at least 1.\n")
+		return 1
+	}
+
+	if *jobs < 1 {
+		fmt.Fprintf(stderr, "Error: -jobs must be at least 1.\n")
+		return 1
+	}
+
+	if *timeout < 0 || *deadline < 0 {
+		fmt.Fprintf(stderr, "Error: -timeout and -deadline must not be negative.\n")
+		return 1
+	}
+
+	// Input files replace running defaults for a domain or -all
+	if len(inputs) > 0 {
+		if *split {
+			fmt.Fprintf(stderr, "Error: Cannot use -i with -split.\n")
+			fs.Usage()
+			return 1
+		}
+		if !*all && len(domainArgs) == 0 {
+			fmt.Fprintf(stderr, "Error: -i requires a domain argument or -all.\n")
+			fs.Usage()
+			return 1
+		}
+		if len(domainArgs) > 1 {
+			fmt.Fprintf(stderr, "Error: -i takes a single domain argument, use -all for the output of `defaults read`.\n")
+			return 1
+		}
+		if *sample != 1 {
+			fmt.Fprintf(stderr, "Error: Cannot use -sample with -i, pass -i once per snapshot instead.\n")
+			return 1
+		}
+	}
+
+	if *noClobber && *force {
+		fmt.Fprintf(stderr, "Error: Cannot use -no-clobber and -force at the same time.\n")
+		fs.Usage()
+		return 1
+	}
+
+	if *force && !*split {
+		fmt.Fprintf(stderr, "Error: -force requires -split, -out always overwrites a single file.\n")
+		fs.Usage()
+		return 1
+	}
+
+	if *prune && !*split {
+		fmt.Fprintf(stderr, "Error: -prune requires -split.\n")
+		fs.Usage()
+		return 1
+	}
+
+	if *merge != "" {
+		if *split {
+			fmt.Fprintf(stderr, "Error: Cannot use -merge with -split.\n")
+			fs.Usage()
+			return 1
+		}
+		if !*all && len(domainArgs) == 0 {
+			fmt.Fprintf(stderr, "Error: -merge requires a domain argument or -all.\n")
+			fs.Usage()
+			return 1
+		}
+	}
+
+	// Handle -out flag based on -split
+	if *split {
+		if *out == "" {
+			fmt.Fprintf(stderr, "Error: -out is mandatory when -split is used.\n")
+			fs.Usage()
+			return 1
+		}
+		fileInfo, err := os.Stat(*out)
+		if os.IsNotExist(err) {
+			// Try to create the directory if it doesn't exist
+			err = os.MkdirAll(*out, 0755)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error creating output directory %s: %v\n", *out, err)
+				return 1
+			}
+		} else if err != nil {
+			fmt.Fprintf(stderr, "Error checking output path %s: %v\n", *out, err)
+			return 1
+		} else if !fileInfo.IsDir() {
+			fmt.Fprintf(stderr, "Error: -out path %s must be a directory when -split is used.\n", *out)
+			fs.Usage()
+			return 1
+		}
+	} else if *out != "" && (*all || len(domainArgs) > 0) {
+		// If -out is provided without -split, it must be a file
+		fileInfo, err := os.Stat(*out)
+		if err == nil && fileInfo.IsDir() {
+			fmt.Fprintf(stderr, "Error: -out path %s must be a file when not using -split.\n", *out)
+			fs.Usage()
+			return 1
+		}
+		if err == nil && *noClobber {
+			fmt.Fprintf(stderr, "Error: -out file %s already exists and -no-clobber is set.\n", *out)
+			return 1
+		}
+	}
+
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
+
+	if *all || (!*split && len(domainArgs) > 1) {
+		// Several domains become one attrset keyed by domain, like -all
+		var samples [][]byte
+		if len(inputs) > 0 {
+			samples, err = readInputs(inputs, stdin)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+				return 1
+			}
+		} else if *all {
+			samples, err = readSamples(ctx, func(ctx context.Context) ([]byte, error) { return env.source.Read(ctx, "") }, *sample, *interval)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error executing 'defaults read': %v\n", err)
+				return 1
+			}
+		} else {
+			s := &splitter{source: env.source, samples: *sample, interval: *interval, timeout: *timeout, jobs: *jobs}
+			results := s.read(ctx, domainArgs)
+			for _, result := range results {
+				if result.err != nil {
+					fmt.Fprintf(stderr, "Error executing 'defaults read %s': %v\n", result.domain, result.err)
+					return 1
+				}
+			}
+			for round := range *sample {
+				outputs := make([][]byte, len(results))
+				for i, result := range results {
+					outputs[i] = result.samples[round]
+				}
+				samples = append(samples, plist.JoinDomains(domainArgs, outputs))
+			}
+		}
+
+		converted, err := plist.ConvertSamples(samples, "", config, queries)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error converting defaults: %v\n", err)
+			return 1
+		}
+		reportVolatile(stderr, converted.Volatile, config.DropVolatile)
+		reportRedacted(stderr, converted.Redacted, config.DropSecrets)
+		if *merge != "" {
+			return writeMerge(stderr, *merge, *out, converted.Value, "", config)
+		}
+		if *out != "" {
+			err = writeFileAtomic(*out, []byte(renderFile(converted.Value, config)), 0644)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error writing to file %s: %v\n", *out, err)
+				return 1
+			}
+		} else {
+			fmt.Fprintln(stdout, renderNix(converted.Value, config))
+		}
+	} else if *split {
+		// Only the domains given are written, or all of them
+		domains := domainArgs
+		if len(domains) == 0 {
+			domains, err = env.source.Domains(ctx)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error executing 'defaults domains': %v\n", err)
+				return 1
+			}
+		}
+
+		// Stop reading on Ctrl-C, but still write the domains that finished
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		successCount := 0
+		var skippedDomains []string
+		var errorDomains []string
+		var timedOutDomains []string
+		var unfinishedDomains []string
+		var redacted []string
+		var volatileKeys []string
+
+		s := &splitter{
+			source:   env.source,
+			config:   config,
+			queries:  queries,
+			samples:  *sample,
+			interval: *interval,
+			timeout:  *timeout,
+			jobs:     *jobs,
+		}
+		// The manifest of the previous run tells which files defaults2nix
+		// wrote, and so which ones it may remove
+		previous, err := readManifest(*out)
+		if err != nil {
+			fmt.Fprintf(stderr, "Warning: Ignoring %s: %v\n", filepath.Join(*out, manifestName), err)
+		}
+		// keepFile records the file the previous run wrote for the domain
+		// of entry in it, so that it isn't taken for a stale file
+		keepFile := func(entry manifestEntry) manifestEntry {
+			if old, ok := previous.entry(entry.Domain); ok && old.SHA256 != "" {
+				entry.File, entry.SHA256 = old.File, old.SHA256
+			}
+			return entry
+		}
+		owned := previous.owned()
+		policy := overwriteOwned
+		if *noClobber {
+			policy = overwriteNever
+		} else if *force {
+			policy = overwriteAlways
+		}
+		var keptFiles []string
+		unchangedCount := 0
+		m := manifest{
+			Version:  toolVersion(),
+			Naming:   string(naming),
+			Format:   *conv.format,
+			Filters:  conv.filterNames(),
+			Select:   conv.selects,
+			Baseline: *conv.baseline,
+		}
+		results := s.convert(ctx, domains)
+
+		// Domains that would be written to the same file are left out
+		var toWrite []string
+		for _, result := range results {
+			if result.status == "" {
+				toWrite = append(toWrite, result.domain)
+			}
+		}
+		collisions := findCollisions(toWrite, naming)
+		colliding := make(map[string]bool)
+		for _, c := range collisions {
+			fmt.Fprintf(stderr, "Error: Domains %s would all be written to %s, so none of them is.\n", strings.Join(c.domains, ", "), c.file)
+			for _, domain := range c.domains {
+				colliding[domain] = true
+			}
+		}
+		// Domains left out of an explicit list keep their files
+		var carried []manifestEntry
+		if len(domainArgs) > 0 {
+			for _, e := range previous.Domains {
+				if !slices.Contains(domains, e.Domain) {
+					carried = append(carried, e)
+				}
+			}
+		}
+		for _, domain := range toWrite {
+			if colliding[domain] {
+				continue
+			}
+			filename := naming.filename(domain)
+			if strings.EqualFold(filename, indexName) {
+				fmt.Fprintf(stderr, "Error: Domain %s would be written to %s, which imports the other files, so it isn't.\n", domain, indexName)
+				collisions = append(collisions, nameCollision{file: indexName, domains: []string{domain}})
+				colliding[domain] = true
+				continue
+			}
+			for _, e := range carried {
+				if e.File != "" && strings.EqualFold(filename, e.File) {
+					fmt.Fprintf(stderr, "Error: Domain %s would be written to %s, which holds %s from an earlier run, so it isn't.\n", domain, e.File, e.Domain)
+					collisions = append(collisions, nameCollision{file: e.File, domains: []string{domain}})
+					colliding[domain] = true
+					break
+				}
+			}
+		}
+
+		// Files are written in domain order once every domain is converted,
+		// so that the output doesn't depend on which job finished first
+		for _, result := range results {
+			domain := result.domain
+			if colliding[domain] {
+				result.status = statusNameCollision
+			}
+			entry := manifestEntry{Domain: domain, Status: result.status}
+			if result.err != nil {
+				entry.Error = result.err.Error()
+			}
+			switch result.status {
+			case statusTimedOut:
+				timedOutDomains = append(timedOutDomains, domain)
+			case statusUnfinished:
+				unfinishedDomains = append(unfinishedDomains, domain)
+			case statusReadError, statusParseError:
+				errorDomains = append(errorDomains, domain)
+			case statusEmpty, statusFilteredEmpty:
+				// Skip empty results
+				skippedDomains = append(skippedDomains, domain)
+			}
+			if result.status == statusEmpty || result.status == statusFilteredEmpty {
+				m.Domains = append(m.Domains, entry)
+				continue
+			}
+			if result.status != "" {
+				// Keep the file of a domain that couldn't be read this time
+				m.Domains = append(m.Domains, keepFile(entry))
+				continue
+			}
+			redacted = append(redacted, result.converted.Redacted...)
+			volatileKeys = append(volatileKeys, result.converted.Volatile...)
+
+			// Write to file, unless it already holds the same contents
+			entry.File = naming.filename(domain)
+			filename := filepath.Join(*out, entry.File)
+			if !mayOverwrite(*out, filename, result.nix, policy, owned) {
+				keptFiles = append(keptFiles, entry.File)
+				entry.Status = statusKept
+				m.Domains = append(m.Domains, entry)
+				continue
+			}
+			err = os.MkdirAll(filepath.Dir(filename), 0755)
+			written := false
+			if err == nil {
+				written, err = writeIfChanged(filename, result.nix)
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "Warning: Failed to write %s: %v\n", filename, err)
+				m.Domains = append(m.Domains, keepFile(manifestEntry{Domain: domain, Status: statusWriteError, Error: err.Error()}))
+				continue
+			}
+			entry.Status = statusWritten
+			if !written {
+				entry.Status = statusUnchanged
+				unchangedCount++
+			}
+			entry.Keys = result.keys
+			entry.SHA256 = contentHash(result.nix)
+			m.Domains = append(m.Domains, entry)
+
+			successCount++
+		}
+		m.Domains = append(m.Domains, carried...)
+
+		// The index imports the files that were written and those kept
+		// from the previous run
+		if index, ok := renderIndex(*out, m, config.Format); ok {
+			filename := filepath.Join(*out, indexName)
+			if !mayOverwrite(*out, filename, index, policy, owned) {
+				keptFiles = append(keptFiles, indexName)
+			} else if _, err := writeIfChanged(filename, index); err != nil {
+				fmt.Fprintf(stderr, "Warning: Failed to write %s: %v\n", filename, err)
+				m.Index = previous.Index
+			} else {
+				m.Index = &indexFile{File: indexName, SHA256: contentHash(index)}
+			}
+		}
+		pruned := m.collectStale(*out, previous, *prune, func(format string, args ...any) {
+			fmt.Fprintf(stderr, format, args...)
+		})
+		if err := writeManifest(*out, m); err != nil {
+			fmt.Fprintf(stderr, "Warning: Failed to write %s: %v\n", filepath.Join(*out, manifestName), err)
+		}
+
+		// Provide detailed feedback
+		if successCount == 0 {
+			fmt.Fprintf(stderr, "Error: No domains could be processed successfully.\n")
+			if len(errorDomains) > 0 {
+				fmt.Fprintf(stderr, "Domains with errors: %s\n", strings.Join(errorDomains, ", "))
+			}
+			if len(timedOutDomains) > 0 {
+				fmt.Fprintf(stderr, "Domains that timed out: %s\n", strings.Join(timedOutDomains, ", "))
+			}
+			reportUnfinished(stderr, ctx.Err(), *deadline, unfinishedDomains)
+			reportKept(stderr, keptFiles, *noClobber)
+			reportStale(stderr, pruned, m.Stale)
+			return 1
+		} else {
+			if len(skippedDomains) > 0 {
+				fmt.Fprintf(stderr, "Info: Skipped %d empty domains: %s\n", len(skippedDomains), strings.Join(skippedDomains, ", "))
+			}
+			if len(errorDomains) > 0 {
+				fmt.Fprintf(stderr, "Warning: Failed to process %d domains: %s\n", len(errorDomains), strings.Join(errorDomains, ", "))
+			}
+			if len(timedOutDomains) > 0 {
+				fmt.Fprintf(stderr, "Warning: Timed out reading %d domains after %s: %s\n", len(timedOutDomains), *timeout, strings.Join(timedOutDomains, ", "))
+			}
+			reportUnfinished(stderr, ctx.Err(), *deadline, unfinishedDomains)
+			reportKept(stderr, keptFiles, *noClobber)
+			if unchangedCount > 0 {
+				fmt.Fprintf(stderr, "Info: Left %d unchanged files as they were\n", unchangedCount)
+			}
+			reportStale(stderr, pruned, m.Stale)
+			reportVolatile(stderr, volatileKeys, config.DropVolatile)
+			reportRedacted(stderr, redacted, config.DropSecrets)
+			fmt.Fprintf(stderr, "Successfully processed %d domains to %s\n", successCount, *out)
+			if len(unfinishedDomains) > 0 || len(collisions) > 0 {
+				return 1
+			}
+		}
+	} else if len(domainArgs) > 0 {
+		domain := domainArgs[0]
+		var samples [][]byte
+		if len(inputs) > 0 {
+			samples, err = readInputs(inputs, stdin)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+				return 1
+			}
+		} else {
+			samples, err = readSamples(ctx, func(ctx context.Context) ([]byte, error) {
+				return readDomain(ctx, env.source, domain, *timeout)
+			}, *sample, *interval)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error executing 'defaults read %s': %v\n", domain, err)
+				return 1
+			}
+		}
+
+		converted, err := plist.ConvertSamples(samples, domain, config, queries)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error converting defaults: %v\n", err)
+			return 1
+		}
+		reportVolatile(stderr, converted.Volatile, config.DropVolatile)
+		reportRedacted(stderr, converted.Redacted, config.DropSecrets)
+		if *merge != "" {
+			return writeMerge(stderr, *merge, *out, converted.Value, domain, config)
+		}
+		if *out != "" {
+			err = writeFileAtomic(*out, []byte(renderFile(converted.Value, config)), 0644)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error writing to file %s: %v\n", *out, err)
+				return 1
+			}
+		} else {
+			fmt.Fprintln(stdout, renderNix(converted.Value, config))
+		}
+	}
+	return 0
+}
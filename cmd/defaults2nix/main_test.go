@@ -0,0 +1,1139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// TestExtractBundleIDs tests the extraction of all top-level keys from parsed values,
+// including bundle IDs, NSGlobalDomain, and custom preference domains
+func TestExtractBundleIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    plist.Value
+		expected []string
+	}{
+		{
+			"Bundle IDs and global domains",
+			plist.DictValue{
+				Values: map[string]plist.Value{
+					"com.apple.Safari":        plist.StringValue{Value: "test"},
+					"com.google.Chrome":       plist.StringValue{Value: "test"},
+					"NSGlobalDomain":          plist.StringValue{Value: "test"},
+					"Custom User Preferences": plist.StringValue{Value: "test"},
+					"loginwindow":             plist.StringValue{Value: "test"},
+					"Apple Global Domain":     plist.StringValue{Value: "test"},
+				},
+				Order: []string{"com.apple.Safari", "com.google.Chrome", "NSGlobalDomain", "Custom User Preferences", "loginwindow", "Apple Global Domain"},
+			},
+			[]string{"com.apple.Safari", "com.google.Chrome", "NSGlobalDomain", "Custom User Preferences", "loginwindow", "Apple Global Domain"},
+		},
+		{
+			"Empty dictionary",
+			plist.DictValue{
+				Values: map[string]plist.Value{},
+				Order:  []string{},
+			},
+			[]string{},
+		},
+		{
+			"Skip binary data",
+			plist.DictValue{
+				Values: map[string]plist.Value{
+					"com.apple.Safari": plist.StringValue{Value: "test"},
+					"binaryData":       plist.SkipValue{},
+					"NSGlobalDomain":   plist.StringValue{Value: "test"},
+				},
+				Order: []string{"com.apple.Safari", "binaryData", "NSGlobalDomain"},
+			},
+			[]string{"com.apple.Safari", "NSGlobalDomain"},
+		},
+		{
+			"Non-dictionary value",
+			plist.StringValue{Value: "not a dict"},
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := extractBundleIDs(tt.input)
+
+			if len(result) != len(tt.expected) {
+				t.Errorf("extractBundleIDs() returned %d keys, want %d", len(result), len(tt.expected))
+			}
+
+			for _, expectedKey := range tt.expected {
+				if _, exists := result[expectedKey]; !exists {
+					t.Errorf("extractBundleIDs() missing expected key: %s", expectedKey)
+				}
+			}
+		})
+	}
+}
+
+// TestSanitizeFilename tests the conversion of domain keys to safe filenames
+// by replacing dots, spaces, and other problematic characters
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Bundle ID with dots", "com.apple.Safari", "com-apple-Safari"},
+		{"Quoted bundle ID", "\"com.google.Chrome\"", "com-google-Chrome"},
+		{"NSGlobalDomain", "NSGlobalDomain", "NSGlobalDomain"},
+		{"Space in name", "Custom User Preferences", "Custom_User_Preferences"},
+		{"Mixed characters", "Apple Global Domain", "Apple_Global_Domain"},
+		{"Forward slash", "path/to/something", "path_to_something"},
+		{"Complex name", "\"Extension Config v2\"", "Extension_Config_v2"},
+		{"loginwindow", "loginwindow", "loginwindow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := sanitizeFilename(tt.input)
+			if result != tt.expected {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSplitFunctionality_Integration(t *testing.T) {
+	// Test the main logic that would be used in split mode
+	input := `{
+    "com.apple.Safari" = {
+        HomePage = "https://example.com";
+        ExtensionsEnabled = 1;
+    };
+    NSGlobalDomain = {
+        AppleInterfaceStyle = Dark;
+        AppleLanguages = ("en-US", "en");
+    };
+    "Custom User Preferences" = {
+        MyCustomSetting = enabled;
+    };
+    loginwindow = {
+        LoginwindowText = Welcome;
+    };
+}`
+
+	value, err := plist.Parse(strings.NewReader(input), "", plist.Options{})
+	if err != nil {
+		t.Fatalf("plist.Parse() error = %v", err)
+	}
+
+	bundleMap := extractBundleIDs(value)
+
+	expectedKeys := []string{"\"com.apple.Safari\"", "NSGlobalDomain", "\"Custom User Preferences\"", "loginwindow"}
+	alternateKeys := []string{"com.apple.Safari", "NSGlobalDomain", "Custom User Preferences", "loginwindow"}
+
+	if len(bundleMap) != len(expectedKeys) {
+		t.Errorf("Expected %d keys, got %d", len(expectedKeys), len(bundleMap))
+	}
+
+	for i, key := range expectedKeys {
+		if _, exists := bundleMap[key]; !exists {
+			if _, exists := bundleMap[alternateKeys[i]]; !exists {
+				t.Errorf("Expected key %s (or %s) not found in bundle map", key, alternateKeys[i])
+			}
+		}
+	}
+
+	// Test individual key content - check both quoted and unquoted versions
+	var safariValue plist.Value
+	var safariExists bool
+	if safariValue, safariExists = bundleMap["\"com.apple.Safari\""]; !safariExists {
+		safariValue, safariExists = bundleMap["com.apple.Safari"]
+	}
+
+	if safariExists {
+		safariNix := safariValue.ToNix(0)
+		if !strings.Contains(safariNix, "HomePage = \"https://example.com\"") {
+			t.Error("Safari config should contain HomePage setting")
+		}
+		if !strings.Contains(safariNix, "ExtensionsEnabled = true") {
+			t.Error("Safari config should contain ExtensionsEnabled setting")
+		}
+	}
+
+	if globalValue, exists := bundleMap["NSGlobalDomain"]; exists {
+		globalNix := globalValue.ToNix(0)
+		if !strings.Contains(globalNix, "AppleInterfaceStyle = \"Dark\"") {
+			t.Error("NSGlobalDomain should contain AppleInterfaceStyle setting")
+		}
+		if !strings.Contains(globalNix, "AppleLanguages = [") {
+			t.Error("NSGlobalDomain should contain AppleLanguages array")
+		}
+	}
+}
+
+// cliDomains are the defaults of the Mac the CLI tests run against
+var cliDomains = plist.MemorySource{
+	"com.apple.Safari": `{
+    HomePage = "https://example.com";
+    ExtensionsEnabled = 1;
+}`,
+	"com.apple.dock": `{
+    autohide = 1;
+    tilesize = 48;
+}`,
+	"com.example.empty": `{
+}`,
+}
+
+// testEnv is the environment of a Mac whose defaults are read from source
+func testEnv(source plist.DefaultsSource) environment {
+	return environment{
+		goos:   "darwin",
+		getenv: func(string) string { return "" },
+		source: source,
+	}
+}
+
+// runCLI runs the command line in env and returns its exit code and output
+func runCLI(env environment, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr, env)
+	return code, stdout.String(), stderr.String()
+}
+
+// brokenSource lists domains that can't be read next to those of a
+// MemorySource, like `defaults domains` does for some sandboxed apps
+type brokenSource struct {
+	plist.MemorySource
+	broken []string
+}
+
+func (s brokenSource) Domains(ctx context.Context) ([]string, error) {
+	domains, err := s.MemorySource.Domains(ctx)
+	return append(domains, s.broken...), err
+}
+
+// TestCLI_FlagValidation tests command-line flag validation
+func TestCLI_FlagValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectExitCode int
+		expectStderr   string
+	}{
+		{
+			name:           "No arguments shows usage",
+			args:           []string{},
+			expectExitCode: 1,
+			expectStderr:   "Usage:",
+		},
+		{
+			name:           "Help flag works",
+			args:           []string{"-h"},
+			expectExitCode: 0, // -h flag exits with 0
+			expectStderr:   "Usage:",
+		},
+		{
+			name:           "Invalid flag combination: -all with domain",
+			args:           []string{"-all", "com.apple.Safari"},
+			expectExitCode: 1,
+			expectStderr:   "Cannot use -all with a domain argument",
+		},
+		{
+			name:           "Missing -out with -split and domains",
+			args:           []string{"-split", "com.apple.Safari"},
+			expectExitCode: 1,
+			expectStderr:   "-out is mandatory when -split is used",
+		},
+		{
+			name:           "Invalid flag combination: -all and -split together",
+			args:           []string{"-all", "-split"},
+			expectExitCode: 1,
+			expectStderr:   "Cannot use -all and -split at the same time",
+		},
+		{
+			name:           "Missing -out with -split",
+			args:           []string{"-split"},
+			expectExitCode: 1,
+			expectStderr:   "-out is mandatory when -split is used",
+		},
+		{
+			name:           "Invalid flag",
+			args:           []string{"-invalid-flag"},
+			expectExitCode: 2, // Flag package exits with 2 for invalid flags
+			expectStderr:   "flag provided but not defined",
+		},
+		{
+			name:           "Multiple domains are keyed by domain",
+			args:           []string{"com.apple.Safari", "com.apple.dock"},
+			expectExitCode: 0,
+			expectStderr:   "",
+		},
+		{
+			name:           "Empty domain among several",
+			args:           []string{"com.apple.Safari", ""},
+			expectExitCode: 1,
+			expectStderr:   "Domain names must not be empty",
+		},
+		{
+			name:           "Multiple domains with -i",
+			args:           []string{"-i", "-", "com.apple.Safari", "com.apple.dock"},
+			expectExitCode: 1,
+			expectStderr:   "-i takes a single domain argument",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exitCode, _, stderr := runCLI(testEnv(cliDomains), tt.args...)
+
+			if exitCode != tt.expectExitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.expectExitCode, exitCode)
+				t.Logf("Command output: %s", stderr)
+			}
+
+			if tt.expectStderr != "" && !strings.Contains(stderr, tt.expectStderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.expectStderr, stderr)
+			}
+		})
+	}
+}
+
+// TestCLI_SingleDomain tests converting a domain to stdout and to a file
+func TestCLI_SingleDomain(t *testing.T) {
+	expected := "{\n  autohide = true;\n  tilesize = 48;\n}\n"
+
+	exitCode, stdout, stderr := runCLI(testEnv(cliDomains), "com.apple.dock")
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if stdout != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	out := filepath.Join(t.TempDir(), "dock.nix")
+	if exitCode, _, stderr := runCLI(testEnv(cliDomains), "-out", out, "com.apple.dock"); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files record their keys for a later -merge
+	expectedFile := expected + "\n# defaults2nix-known: [[\"autohide\"],[\"tilesize\"]]\n"
+	if string(data) != expectedFile {
+		t.Errorf("Expected %s to hold:\n%s\ngot:\n%s", out, expectedFile, data)
+	}
+}
+
+// TestCLI_MultipleDomains tests converting several domains into one attrset
+func TestCLI_MultipleDomains(t *testing.T) {
+	expected := "{\n  \"com.apple.dock\" = {\n    autohide = true;\n    tilesize = 48;\n  };\n  \"com.apple.Safari\" = {\n    HomePage = \"https://example.com\";\n    ExtensionsEnabled = true;\n  };\n}\n"
+
+	// Domains are keyed in the order given, each read once
+	exitCode, stdout, stderr := runCLI(testEnv(cliDomains), "com.apple.dock", "com.apple.Safari", "com.apple.dock")
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if stdout != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	// Flags may follow the domains
+	out := filepath.Join(t.TempDir(), "ui.nix")
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "com.apple.dock", "com.apple.Safari", "-o", out)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0 with a trailing flag, got %d: %s", exitCode, stderr)
+	}
+	if data, err := os.ReadFile(out); err != nil || !strings.HasPrefix(string(data), expected+"\n# defaults2nix-known: ") {
+		t.Errorf("Expected %s to hold:\n%s\ngot:\n%s (%v)", out, expected, data, err)
+	}
+	exitCode, stdout, stderr = runCLI(testEnv(cliDomains), "com.apple.dock", "-filter", "state", "--", "com.apple.Safari")
+	if exitCode != 0 || stdout != expected {
+		t.Errorf("Expected the domains before and after -- to be converted, got exit code %d:\n%s%s", exitCode, stdout, stderr)
+	}
+
+	// A domain that can't be read fails the whole run
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "com.apple.dock", "com.example.missing")
+	if exitCode != 1 || !strings.Contains(stderr, "Error executing 'defaults read com.example.missing'") {
+		t.Errorf("Expected a missing domain to fail, got exit code %d: %s", exitCode, stderr)
+	}
+}
+
+// TestSplitMode_ExplicitDomains tests that -split only writes the domains given
+func TestSplitMode_ExplicitDomains(t *testing.T) {
+	outputDir := t.TempDir()
+	exitCode, _, stderr := runCLI(testEnv(cliDomains), "-split", "-out", outputDir, "com.apple.dock")
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "com-apple-dock.nix")); err != nil {
+		t.Errorf("Expected com-apple-dock.nix to be written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "com-apple-Safari.nix")); !os.IsNotExist(err) {
+		t.Errorf("Expected com-apple-Safari.nix not to be written, got: %v", err)
+	}
+
+	// Domains left out of a later run are kept, even with -prune
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "-split", "-prune", "-out", outputDir, "com.apple.Safari")
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	for _, file := range []string{"com-apple-dock.nix", "com-apple-Safari.nix"} {
+		if _, err := os.Stat(filepath.Join(outputDir, file)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", file, err)
+		}
+	}
+	index, err := os.ReadFile(filepath.Join(outputDir, "default.nix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"./com-apple-dock.nix", "./com-apple-Safari.nix"} {
+		if !strings.Contains(string(index), file) {
+			t.Errorf("Expected default.nix to import %s, got:\n%s", file, index)
+		}
+	}
+
+	// A domain isn't written over the file another domain kept from an
+	// earlier run
+	source := plist.MemorySource{
+		"com.foo.bar": "{\n    owner = bar;\n}",
+		"com.foo-bar": "{\n    owner = dash;\n}",
+	}
+	outputDir = t.TempDir()
+	if exitCode, _, stderr := runCLI(testEnv(source), "-split", "-out", outputDir, "com.foo.bar"); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	exitCode, _, stderr = runCLI(testEnv(source), "-split", "-out", outputDir, "com.foo-bar")
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for a name collision, got %d", exitCode)
+	}
+	if !strings.Contains(stderr, "Error: Domain com.foo-bar would be written to com-foo-bar.nix, which holds com.foo.bar from an earlier run, so it isn't.") {
+		t.Errorf("Expected the collision to be reported, got: %s", stderr)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "com-foo-bar.nix"))
+	if err != nil || !strings.Contains(string(data), "owner = \"bar\";") {
+		t.Errorf("Expected com-foo-bar.nix to still hold com.foo.bar, got: %s (%v)", data, err)
+	}
+	m, err := readManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range m.Domains {
+		if e.Domain == "com.foo-bar" && e.File != "" {
+			t.Errorf("Expected com.foo-bar not to have a file, got %+v", e)
+		}
+	}
+}
+
+// TestCLI_PlatformCheck tests that the tool properly checks for macOS
+func TestCLI_PlatformCheck(t *testing.T) {
+	env := testEnv(cliDomains)
+	env.goos = "linux"
+	exitCode, _, stderr := runCLI(env, "com.apple.Safari")
+
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for non-macOS platform, got %d", exitCode)
+	}
+
+	expectedMessages := []string{
+		"designed for macOS only",
+		"requires 'defaults' command",
+		"Current platform: linux",
+	}
+
+	for _, expected := range expectedMessages {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected output to contain %q, got: %s", expected, stderr)
+		}
+	}
+
+	// Saved output doesn't need macOS
+	dump := filepath.Join(t.TempDir(), "dump.txt")
+	if err := os.WriteFile(dump, []byte(cliDomains["com.apple.dock"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exitCode, stdout, stderr := runCLI(env, "-i", dump, "com.apple.dock")
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0 with -i on linux, got %d: %s", exitCode, stderr)
+	}
+	if !strings.Contains(stdout, "autohide = true;") {
+		t.Errorf("Expected the dump to be converted, got: %s", stdout)
+	}
+}
+
+// TestCLI_OutputFileValidation tests output file validation
+func TestCLI_OutputFileValidation(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Create a file to test directory vs file validation
+	testFile := tempDir + "/testfile"
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectExitCode int
+		expectStderr   string
+	}{
+		{
+			name:           "Split with file instead of directory",
+			args:           []string{"-split", "-out", testFile},
+			expectExitCode: 1,
+			expectStderr:   "must be a directory when -split is used",
+		},
+		{
+			name:           "Non-split with directory instead of file",
+			args:           []string{"-all", "-out", tempDir},
+			expectExitCode: 1,
+			expectStderr:   "must be a file when not using -split",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exitCode, _, stderr := runCLI(testEnv(cliDomains), tt.args...)
+
+			if exitCode != tt.expectExitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.expectExitCode, exitCode)
+				t.Logf("Command output: %s", stderr)
+			}
+
+			if tt.expectStderr != "" && !strings.Contains(stderr, tt.expectStderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.expectStderr, stderr)
+			}
+		})
+	}
+}
+
+// TestFileOperations_ErrorHandling tests file I/O error scenarios
+func TestFileOperations_ErrorHandling(t *testing.T) {
+	tempDir := t.TempDir()
+	
+	tests := []struct {
+		name        string
+		setupFunc   func() string // Returns file/dir path to test
+		expectError bool
+	}{
+		{
+			name: "Write to read-only directory",
+			setupFunc: func() string {
+				readOnlyDir := tempDir + "/readonly"
+				if err := os.Mkdir(readOnlyDir, 0444); err != nil {
+					t.Fatalf("Failed to create readonly dir: %v", err)
+				}
+				return readOnlyDir + "/test.nix"
+			},
+			expectError: true,
+		},
+		{
+			name: "Write to non-existent directory path",
+			setupFunc: func() string {
+				return tempDir + "/nonexistent/path/file.nix"
+			},
+			expectError: true,
+		},
+		{
+			name: "Write to existing file with different permissions",
+			setupFunc: func() string {
+				restrictedFile := tempDir + "/restricted.nix"
+				if err := os.WriteFile(restrictedFile, []byte("test"), 0000); err != nil {
+					t.Fatalf("Failed to create restricted file: %v", err)
+				}
+				return restrictedFile
+			},
+			expectError: true,
+		},
+		{
+			name: "Write to valid path",
+			setupFunc: func() string {
+				return tempDir + "/valid.nix"
+			},
+			expectError: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := tt.setupFunc()
+			
+			// Test writing a simple Nix configuration
+			testContent := `{
+  TestSetting = true;
+  HomePage = "https://example.com";
+}`
+			
+			err := os.WriteFile(filePath, []byte(testContent), 0644)
+			
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error writing to %s, but succeeded", filePath)
+			}
+			
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected success writing to %s, but got error: %v", filePath, err)
+			}
+		})
+	}
+}
+
+// TestDirectoryOperations_ErrorHandling tests directory creation and validation
+func TestDirectoryOperations_ErrorHandling(t *testing.T) {
+	tempDir := t.TempDir()
+	
+	tests := []struct {
+		name        string
+		setupFunc   func() string // Returns directory path to test
+		expectError bool
+	}{
+		{
+			name: "Create directory in read-only parent",
+			setupFunc: func() string {
+				readOnlyParent := tempDir + "/readonly_parent"
+				if err := os.Mkdir(readOnlyParent, 0444); err != nil {
+					t.Fatalf("Failed to create readonly parent: %v", err)
+				}
+				return readOnlyParent + "/newdir"
+			},
+			expectError: true,
+		},
+		{
+			name: "Create nested directory path",
+			setupFunc: func() string {
+				return tempDir + "/nested/deep/path"
+			},
+			expectError: false,
+		},
+		{
+			name: "Create directory where file exists",
+			setupFunc: func() string {
+				existingFile := tempDir + "/existing_file"
+				if err := os.WriteFile(existingFile, []byte("test"), 0644); err != nil {
+					t.Fatalf("Failed to create existing file: %v", err)
+				}
+				return existingFile
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dirPath := tt.setupFunc()
+			
+			err := os.MkdirAll(dirPath, 0755)
+			
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error creating directory %s, but succeeded", dirPath)
+			}
+			
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected success creating directory %s, but got error: %v", dirPath, err)
+			}
+		})
+	}
+}
+
+// TestSplitMode_FileOperationErrors tests error scenarios in split mode file operations
+func TestSplitMode_FileOperationErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	
+	// Test the core logic that split mode uses for file operations
+	bundleData := map[string]plist.Value{
+		"com.apple.Safari": plist.DictValue{
+			Values: map[string]plist.Value{
+				"HomePage": plist.StringValue{Value: "https://example.com"},
+			},
+			Order: []string{"HomePage"},
+		},
+		"NSGlobalDomain": plist.DictValue{
+			Values: map[string]plist.Value{
+				"AppleInterfaceStyle": plist.StringValue{Value: "Dark"},
+			},
+			Order: []string{"AppleInterfaceStyle"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		setupFunc   func() string // Returns output directory path
+		expectError bool
+	}{
+		{
+			name: "Valid output directory",
+			setupFunc: func() string {
+				validDir := tempDir + "/valid_output"
+				if err := os.Mkdir(validDir, 0755); err != nil {
+					t.Fatalf("Failed to create valid dir: %v", err)
+				}
+				return validDir
+			},
+			expectError: false,
+		},
+		{
+			name: "Read-only output directory", 
+			setupFunc: func() string {
+				readOnlyDir := tempDir + "/readonly_output"
+				if err := os.Mkdir(readOnlyDir, 0444); err != nil {
+					t.Fatalf("Failed to create readonly dir: %v", err)
+				}
+				return readOnlyDir
+			},
+			expectError: true,
+		},
+		{
+			name: "Output directory is actually a file",
+			setupFunc: func() string {
+				filePath := tempDir + "/not_a_dir"
+				if err := os.WriteFile(filePath, []byte("test"), 0644); err != nil {
+					t.Fatalf("Failed to create file: %v", err)
+				}
+				return filePath
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := tt.setupFunc()
+			
+			// Simulate split mode file writing
+			var writeErrors []error
+			for bundleID, bundleValue := range bundleData {
+				nixContent := bundleValue.ToNix(0)
+				filename := outputDir + "/" + sanitizeFilename(bundleID) + ".nix"
+				
+				err := os.WriteFile(filename, []byte(nixContent), 0644)
+				if err != nil {
+					writeErrors = append(writeErrors, err)
+				}
+			}
+
+			hasErrors := len(writeErrors) > 0
+			
+			if tt.expectError && !hasErrors {
+				t.Errorf("Expected file write errors, but all writes succeeded")
+			}
+			
+			if !tt.expectError && hasErrors {
+				t.Errorf("Expected successful file writes, but got errors: %v", writeErrors)
+			}
+		})
+	}
+}
+
+// TestCommandExecution_FailureHandling tests handling of defaults command failures
+func TestCommandExecution_FailureHandling(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectExitCode int
+		expectStderr   string
+	}{
+		{
+			name:           "Invalid domain name",
+			args:           []string{"com.nonexistent.invalid.domain.that.does.not.exist"},
+			expectExitCode: 1,
+			expectStderr:   "Error executing 'defaults read",
+		},
+		{
+			name:           "Domain with special characters",
+			args:           []string{"invalid$domain@name"},
+			expectExitCode: 1,
+			expectStderr:   "Error executing 'defaults read",
+		},
+		{
+			name:           "Empty domain name",
+			args:           []string{""},
+			expectExitCode: 1,
+			expectStderr:   "Error: Domain names must not be empty",
+		},
+		{
+			name:           "Very long domain name",
+			args:           []string{strings.Repeat("a", 1000) + ".domain"},
+			expectExitCode: 1,
+			expectStderr:   "Error executing 'defaults read",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exitCode, _, stderr := runCLI(testEnv(cliDomains), tt.args...)
+
+			if exitCode != tt.expectExitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.expectExitCode, exitCode)
+				t.Logf("Command output: %s", stderr)
+			}
+
+			if tt.expectStderr != "" && !strings.Contains(stderr, tt.expectStderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.expectStderr, stderr)
+			}
+		})
+	}
+}
+
+// TestSplitMode_DomainCommandFailures tests split mode behavior when defaults commands fail
+func TestSplitMode_DomainCommandFailures(t *testing.T) {
+	outputDir := t.TempDir()
+
+	// Domains that fail to read are reported, the others are still written
+	source := brokenSource{MemorySource: cliDomains, broken: []string{"com.example.broken"}}
+	exitCode, _, stderr := runCLI(testEnv(source), "-split", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+
+	expectedMessages := []string{
+		"Info: Skipped 1 empty domains: com.example.empty",
+		"Warning: Failed to process 1 domains: com.example.broken",
+		"Successfully processed 2 domains to " + outputDir,
+	}
+	for _, expected := range expectedMessages {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected output to contain %q, got: %s", expected, stderr)
+		}
+	}
+	for _, file := range []string{"com-apple-Safari.nix", "com-apple-dock.nix"} {
+		if _, err := os.Stat(filepath.Join(outputDir, file)); err != nil {
+			t.Errorf("Expected %s to be written: %v", file, err)
+		}
+	}
+
+	// Failing every domain is an error
+	source = brokenSource{broken: []string{"com.example.broken"}}
+	exitCode, _, stderr = runCLI(testEnv(source), "-split", "-out", t.TempDir())
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 when no domain can be read, got %d", exitCode)
+	}
+	if !strings.Contains(stderr, "Error: No domains could be processed successfully.") ||
+		!strings.Contains(stderr, "Domains with errors: com.example.broken") {
+		t.Errorf("Expected error message in output, got: %s", stderr)
+	}
+}
+
+// slowSource is a brokenSource whose reads take a while, like `defaults
+// read` does, and that records how many reads ran at the same time. Reads
+// of hung domains only return once ctx is done.
+type slowSource struct {
+	brokenSource
+	delay time.Duration
+	hung  []string
+
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (s *slowSource) Read(ctx context.Context, domain string) ([]byte, error) {
+	s.mu.Lock()
+	s.running++
+	s.peak = max(s.peak, s.running)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+
+	var done <-chan time.Time
+	if !slices.Contains(s.hung, domain) {
+		done = time.After(s.delay)
+	}
+	select {
+	case <-done:
+		return s.brokenSource.Read(ctx, domain)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("signal: killed")
+	}
+}
+
+// TestSplitMode_Jobs tests that domains are processed in parallel without
+// changing the files written or the summary
+func TestSplitMode_Jobs(t *testing.T) {
+	domains := plist.MemorySource{}
+	for domain, output := range cliDomains {
+		domains[domain] = output
+	}
+	for i := range 12 {
+		domains[fmt.Sprintf("com.example.app%02d", i)] = fmt.Sprintf("{\n    level = %d;\n}", i)
+	}
+
+	split := func(jobs int, broken ...string) (string, map[string]string, int) {
+		source := &slowSource{
+			brokenSource: brokenSource{MemorySource: domains, broken: broken},
+			delay:        5 * time.Millisecond,
+		}
+		outputDir := t.TempDir()
+		exitCode, _, stderr := runCLI(testEnv(source), "-split", "-jobs", fmt.Sprint(jobs), "-out", outputDir)
+		if exitCode != 0 {
+			t.Fatalf("Expected exit code 0 with -jobs %d, got %d: %s", jobs, exitCode, stderr)
+		}
+		files := make(map[string]string)
+		entries, err := os.ReadDir(outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(outputDir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[entry.Name()] = string(data)
+		}
+		return strings.ReplaceAll(stderr, outputDir, "<out>"), files, source.peak
+	}
+
+	stderr1, files1, peak1 := split(1, "com.example.broken", "com.example.alsobroken")
+	stderr4, files4, peak4 := split(4, "com.example.broken", "com.example.alsobroken")
+
+	if peak1 != 1 {
+		t.Errorf("Expected one read at a time with -jobs 1, got %d", peak1)
+	}
+	if peak4 < 2 || peak4 > 4 {
+		t.Errorf("Expected between 2 and 4 reads at a time with -jobs 4, got %d", peak4)
+	}
+	if stderr1 != stderr4 {
+		t.Errorf("Expected the same summary with -jobs 1 and 4, got:\n%s\nand:\n%s", stderr1, stderr4)
+	}
+	if !strings.Contains(stderr4, "Warning: Failed to process 2 domains: com.example.broken, com.example.alsobroken") {
+		t.Errorf("Expected failed domains in domain order, got: %s", stderr4)
+	}
+	if len(files4) != 16 {
+		t.Errorf("Expected 16 files, 14 domains, the index and the manifest, got %d files", len(files4))
+	}
+	for name, content := range files1 {
+		if files4[name] != content {
+			t.Errorf("Expected %s to be the same with -jobs 1 and 4, got:\n%s\nand:\n%s", name, content, files4[name])
+		}
+	}
+
+	exitCode, _, stderr := runCLI(testEnv(cliDomains), "-split", "-jobs", "0", "-out", t.TempDir())
+	if exitCode != 1 || !strings.Contains(stderr, "Error: -jobs must be at least 1.") {
+		t.Errorf("Expected -jobs 0 to be rejected, got exit code %d: %s", exitCode, stderr)
+	}
+}
+
+// TestSplitMode_Timeouts tests that hung domains time out and that a run
+// cut short by its deadline or Ctrl-C still writes the finished domains
+func TestSplitMode_Timeouts(t *testing.T) {
+	hungSource := func() *slowSource {
+		return &slowSource{
+			brokenSource: brokenSource{MemorySource: cliDomains, broken: []string{"com.example.hung"}},
+			hung:         []string{"com.example.hung"},
+		}
+	}
+	checkWritten := func(outputDir string) {
+		for _, file := range []string{"com-apple-Safari.nix", "com-apple-dock.nix"} {
+			if _, err := os.Stat(filepath.Join(outputDir, file)); err != nil {
+				t.Errorf("Expected %s to be written: %v", file, err)
+			}
+		}
+	}
+
+	// A hung domain times out and the others are written
+	outputDir := t.TempDir()
+	exitCode, _, stderr := runCLI(testEnv(hungSource()), "-split", "-timeout", "50ms", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if !strings.Contains(stderr, "Warning: Timed out reading 1 domains after 50ms: com.example.hung") {
+		t.Errorf("Expected timed out domain in output, got: %s", stderr)
+	}
+	if strings.Contains(stderr, "Failed to process") {
+		t.Errorf("Expected timed out domains apart from failed ones, got: %s", stderr)
+	}
+	checkWritten(outputDir)
+
+	// The deadline stops the run, reporting what didn't finish
+	outputDir = t.TempDir()
+	exitCode, _, stderr = runCLI(testEnv(hungSource()), "-split", "-timeout", "0", "-deadline", "100ms", "-out", outputDir)
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 when the deadline is reached, got %d", exitCode)
+	}
+	for _, expected := range []string{
+		"Warning: Deadline of 100ms reached before 1 domains were processed: com.example.hung",
+		"Successfully processed 2 domains to " + outputDir,
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected output to contain %q, got: %s", expected, stderr)
+		}
+	}
+	checkWritten(outputDir)
+
+	// Ctrl-C cancels the context the same way
+	outputDir = t.TempDir()
+	ctx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	time.AfterFunc(100*time.Millisecond, interrupt)
+	var stdout, errOut bytes.Buffer
+	exitCode = run(ctx, []string{"-split", "-timeout", "0", "-out", outputDir}, strings.NewReader(""), &stdout, &errOut, testEnv(hungSource()))
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 when interrupted, got %d", exitCode)
+	}
+	if !strings.Contains(errOut.String(), "Warning: Interrupted before 1 domains were processed: com.example.hung") {
+		t.Errorf("Expected interrupted domain in output, got: %s", errOut.String())
+	}
+	checkWritten(outputDir)
+
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "-split", "-timeout", "-1s", "-out", t.TempDir())
+	if exitCode != 1 || !strings.Contains(stderr, "Error: -timeout and -deadline must not be negative.") {
+		t.Errorf("Expected a negative -timeout to be rejected, got exit code %d: %s", exitCode, stderr)
+	}
+}
+
+// TestSystemIntegration_SplitModeWorkflow tests the complete split mode workflow
+func TestSystemIntegration_SplitModeWorkflow(t *testing.T) {
+	// Test the split mode logic with realistic data
+	input := `{
+    "com.apple.Safari" = {
+        HomePage = "https://example.com";
+        ExtensionsEnabled = 1;
+        TestDate = "2025-06-07 12:01:44 +0000";
+    };
+    NSGlobalDomain = {
+        AppleInterfaceStyle = Dark;
+        AppleLanguages = ("en-US", "en");
+        AnotherDate = "2024-12-25T10:00:00Z";
+    };
+    "com.microsoft.VSCode" = {
+        AutoUpdateMode = automatic;
+        EnableTelemetry = 0;
+        FontFamily = "SF Mono";
+    };
+    "Custom Domain With Spaces" = {
+        CustomSetting = "value with spaces";
+        NumericSetting = 42;
+    };
+}`
+
+	tests := []struct {
+		name      string
+		config    plist.Options
+		expectFiles []string
+		validateContent func(bundleID, content string) error
+	}{
+		{
+			name:   "Split with dates preserved",
+			config: plist.Options{NoDates: false},
+			expectFiles: []string{
+				"com-apple-Safari.nix",
+				"NSGlobalDomain.nix", 
+				"com-microsoft-VSCode.nix",
+				"Custom_Domain_With_Spaces.nix",
+			},
+			validateContent: func(bundleID, content string) error {
+				switch bundleID {
+				case "com-apple-Safari":
+					if !strings.Contains(content, "HomePage = \"https://example.com\";") {
+						return fmt.Errorf("Safari should contain HomePage")
+					}
+					if !strings.Contains(content, "ExtensionsEnabled = true;") {
+						return fmt.Errorf("Safari should convert boolean")
+					}
+					if !strings.Contains(content, "TestDate = \"2025-06-07 12:01:44 +0000\";") {
+						return fmt.Errorf("Safari should preserve dates when NoDates=false")
+					}
+				case "NSGlobalDomain":
+					if !strings.Contains(content, "AppleInterfaceStyle = \"Dark\";") {
+						return fmt.Errorf("NSGlobalDomain should contain AppleInterfaceStyle")
+					}
+					if !strings.Contains(content, "AppleLanguages = [") {
+						return fmt.Errorf("NSGlobalDomain should contain AppleLanguages array")
+					}
+				case "com-microsoft-VSCode":
+					if !strings.Contains(content, "EnableTelemetry = false;") {
+						return fmt.Errorf("VSCode should convert boolean")
+					}
+					if !strings.Contains(content, "FontFamily = \"SF Mono\";") {
+						return fmt.Errorf("VSCode should handle string with spaces")
+					}
+				case "Custom_Domain_With_Spaces":
+					if !strings.Contains(content, "CustomSetting = \"value with spaces\";") {
+						return fmt.Errorf("Custom domain should handle spaced values")
+					}
+					if !strings.Contains(content, "NumericSetting = 42;") {
+						return fmt.Errorf("Custom domain should handle numeric values")
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:   "Split with dates omitted",
+			config: plist.Options{NoDates: true},
+			expectFiles: []string{
+				"com-apple-Safari.nix",
+				"NSGlobalDomain.nix",
+				"com-microsoft-VSCode.nix", 
+				"Custom_Domain_With_Spaces.nix",
+			},
+			validateContent: func(bundleID, content string) error {
+				// Should not contain any date fields
+				if strings.Contains(content, "TestDate") || strings.Contains(content, "AnotherDate") {
+					return fmt.Errorf("dates should be omitted from %s when NoDates=true", bundleID)
+				}
+				
+				// Should still contain non-date content
+				if bundleID == "com-apple-Safari" && !strings.Contains(content, "HomePage") {
+					return fmt.Errorf("non-date content should be preserved in %s", bundleID)
+				}
+				
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Parse the input
+			value, err := plist.Parse(strings.NewReader(input), "", tt.config)
+			if err != nil {
+				t.Fatalf("Failed to parse input: %v", err)
+			}
+			
+			// Extract bundle IDs
+			bundleMap := extractBundleIDs(value)
+			if len(bundleMap) != len(tt.expectFiles) {
+				t.Errorf("Expected %d bundle IDs, got %d", len(tt.expectFiles), len(bundleMap))
+			}
+			
+			// Validate each expected file
+			for _, expectedFile := range tt.expectFiles {
+				bundleID := strings.TrimSuffix(expectedFile, ".nix")
+				
+				// Try both with and without quotes  
+				var bundleValue plist.Value
+				var found bool
+				for key, val := range bundleMap {
+					if sanitizeFilename(key) == bundleID {
+						bundleValue = val
+						found = true
+						break
+					}
+				}
+				
+				if !found {
+					t.Errorf("Expected bundle ID for file %s not found", expectedFile)
+					continue
+				}
+				
+				// Generate content and validate
+				content := bundleValue.ToNix(0)
+				if err := tt.validateContent(bundleID, content); err != nil {
+					t.Errorf("Content validation failed for %s: %v", expectedFile, err)
+					t.Logf("Generated content for %s:\n%s", expectedFile, content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// manifestName is the file -split describes its run in, next to the Nix
+// files it writes.
+const manifestName = "manifest.json"
+
+// domainStatus is what -split did with a domain.
+type domainStatus string
+
+const (
+	statusWritten       domainStatus = "written"        // Written to its file
+	statusUnchanged     domainStatus = "unchanged"      // Its file already held the same contents
+	statusEmpty         domainStatus = "empty"          // Has no keys
+	statusFilteredEmpty domainStatus = "filtered-empty" // Has no keys left after filtering
+	statusReadError     domainStatus = "read-error"     // Couldn't be read
+	statusParseError    domainStatus = "parse-error"    // Couldn't be converted
+	statusTimedOut      domainStatus = "timed-out"      // Reading took longer than -timeout
+	statusUnfinished    domainStatus = "unfinished"     // Not read before the run was interrupted or hit -deadline
+	statusWriteError    domainStatus = "write-error"    // Converted, but its file couldn't be written
+	statusKept          domainStatus = "kept"           // Its file exists and wasn't overwritten, see overwritePolicy
+	statusNameCollision domainStatus = "name-collision" // Another domain would be written to the same file
+)
+
+// manifest describes a -split run, so that scripts can see what it did
+// without reading its messages.
+type manifest struct {
+	Version  string          `json:"version"`            // Version of defaults2nix
+	Naming   string          `json:"naming"`             // How files are named, see namingScheme
+	Format   string          `json:"format"`             // Nix configuration the files are written for
+	Filters  []string        `json:"filters"`            // Names of the -filter options
+	Select   []string        `json:"select,omitempty"`   // Key paths given with -select
+	Baseline string          `json:"baseline,omitempty"` // File given with -baseline
+	Domains  []manifestEntry `json:"domains"`            // Every domain, in the order they were listed
+	Index    *indexFile      `json:"index,omitempty"`    // The default.nix importing every file
+	Stale    []staleFile     `json:"stale,omitempty"`    // Files of earlier runs that -prune would remove
+}
+
+// manifestEntry is a single domain of a manifest.
+type manifestEntry struct {
+	Domain string       `json:"domain"`
+	Status domainStatus `json:"status"`
+	File   string       `json:"file,omitempty"`   // Name of the file within the output directory
+	Keys   int          `json:"keys"`             // Number of top level keys written
+	SHA256 string       `json:"sha256,omitempty"` // Hash of the file contents
+	Error  string       `json:"error,omitempty"`
+}
+
+// staleFile is a file an earlier -split run wrote for a domain that is gone
+// or has nothing left to write.
+type staleFile struct {
+	Domain string `json:"domain,omitempty"` // Empty for the index
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// readManifest reads the manifest of the output directory dir. It returns
+// an empty manifest when there is none yet.
+func readManifest(dir string) (manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return manifest{}, nil
+	}
+	if err != nil {
+		return manifest{}, err
+	}
+	var m manifest
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// owned returns the files in the output directory that m records as
+// written by defaults2nix, by file name. Names that point outside the
+// directory are ignored.
+func (m manifest) owned() map[string]staleFile {
+	files := make(map[string]staleFile)
+	for _, e := range m.Domains {
+		if e.File != "" && e.SHA256 != "" && filepath.IsLocal(e.File) {
+			files[e.File] = staleFile{Domain: e.Domain, File: e.File, SHA256: e.SHA256}
+		}
+	}
+	if m.Index != nil && filepath.IsLocal(m.Index.File) {
+		files[m.Index.File] = staleFile{File: m.Index.File, SHA256: m.Index.SHA256}
+	}
+	for _, f := range m.Stale {
+		if filepath.IsLocal(f.File) {
+			files[f.File] = f
+		}
+	}
+	return files
+}
+
+// entry returns the entry of domain.
+func (m manifest) entry(domain string) (manifestEntry, bool) {
+	for _, e := range m.Domains {
+		if e.Domain == domain {
+			return e, true
+		}
+	}
+	return manifestEntry{}, false
+}
+
+// writeManifest writes m to the manifest of the output directory dir.
+func writeManifest(dir string, m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeIfChanged(filepath.Join(dir, manifestName), string(append(data, '\n')))
+	return err
+}
+
+// contentHash returns the hex encoded SHA-256 hash of a file's contents.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyCount returns the number of top level keys of value. Filters that only
+// apply while rendering are not taken into account, so count the keys of
+// the value parsed back from the rendered file.
+func keyCount(value plist.Value) int {
+	dict, ok := value.(plist.DictValue)
+	if !ok {
+		return 0
+	}
+	count := 0
+	for _, v := range dict.Values {
+		if _, isSkip := v.(plist.SkipValue); !isSkip {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestSplitMode_Manifest(t *testing.T) {
+	source := brokenSource{
+		MemorySource: plist.MemorySource{
+			"com.apple.dock": `{
+    autohide = 1;
+    "Column Width" = 200;
+    tilesize = 48;
+}`,
+			"com.example.columns": `{
+    "Column Width" = 200;
+    FooCache = 1;
+}`,
+			"com.example.empty":   "{\n}",
+			"com.example.garbage": "not a dictionary",
+			"com.example.windows": `{
+    "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+}`,
+		},
+		broken: []string{"com.example.broken"},
+	}
+	outputDir := t.TempDir()
+	exitCode, _, stderr := runCLI(testEnv(source), "-split", "-filter", "state,Dates", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Manifest isn't valid JSON: %v\n%s", err, data)
+	}
+	if m.Version != toolVersion() || m.Format != "plain" {
+		t.Errorf("Expected version %s and format plain, got %s and %s", toolVersion(), m.Version, m.Format)
+	}
+	if len(m.Filters) != 2 || m.Filters[0] != "state" || m.Filters[1] != "dates" {
+		t.Errorf("Expected filters [state dates], got %v", m.Filters)
+	}
+
+	dock, err := os.ReadFile(filepath.Join(outputDir, "com-apple-dock.nix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []manifestEntry{
+		{Domain: "com.apple.dock", Status: statusWritten, File: "com-apple-dock.nix", Keys: 2, SHA256: contentHash(string(dock))},
+		{Domain: "com.example.columns", Status: statusFilteredEmpty},
+		{Domain: "com.example.empty", Status: statusEmpty},
+		{Domain: "com.example.garbage", Status: statusParseError, Error: "defaults output is not a dictionary"},
+		{Domain: "com.example.windows", Status: statusFilteredEmpty},
+		{Domain: "com.example.broken", Status: statusReadError, Error: "Domain com.example.broken does not exist"},
+	}
+	if len(m.Domains) != len(expected) {
+		t.Fatalf("Expected %d domains in the manifest, got %d: %+v", len(expected), len(m.Domains), m.Domains)
+	}
+	for i, entry := range expected {
+		if m.Domains[i] != entry {
+			t.Errorf("Expected manifest entry %+v, got %+v", entry, m.Domains[i])
+		}
+	}
+}
+
+func TestSplitMode_IncrementalAndPrune(t *testing.T) {
+	outputDir := t.TempDir()
+	dock := `{
+    autohide = 1;
+}`
+	windows := `{
+    "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+}`
+	split := func(source plist.DefaultsSource, args ...string) string {
+		t.Helper()
+		exitCode, _, stderr := runCLI(testEnv(source), append([]string{"-split", "-out", outputDir}, args...)...)
+		if exitCode != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+		}
+		return stderr
+	}
+	exists := func(file string) bool {
+		_, err := os.Stat(filepath.Join(outputDir, file))
+		return err == nil
+	}
+
+	split(plist.MemorySource{
+		"com.apple.Safari":    `{ HomePage = "https://example.com"; }`,
+		"com.apple.dock":      dock,
+		"com.example.windows": windows,
+	})
+	// Files defaults2nix didn't write are never touched
+	if err := os.WriteFile(filepath.Join(outputDir, "mine.nix"), []byte("{ }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(outputDir, "com-apple-dock.nix"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	// Safari is gone and the window frame is filtered out, but their files
+	// are only removed with -prune
+	stderr := split(plist.MemorySource{
+		"com.apple.dock":      dock,
+		"com.example.windows": windows,
+	}, "-filter", "state")
+	for _, expected := range []string{
+		"Info: Left 1 unchanged files as they were",
+		"Info: 2 files belong to domains that are gone or empty, remove them with -prune: com-apple-Safari.nix, com-example-windows.nix",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected output to contain %q, got: %s", expected, stderr)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(outputDir, "com-apple-dock.nix")); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("Expected the unchanged file to be left alone, got %v", err)
+	}
+	if !exists("com-apple-Safari.nix") || !exists("com-example-windows.nix") {
+		t.Error("Expected stale files to be kept without -prune")
+	}
+	m, err := readManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := m.entry("com.apple.dock"); entry.Status != statusUnchanged {
+		t.Errorf("Expected com.apple.dock to be unchanged, got %s", entry.Status)
+	}
+	if len(m.Stale) != 2 {
+		t.Errorf("Expected 2 stale files in the manifest, got %+v", m.Stale)
+	}
+
+	// Edited files and the files of domains that can't be read are kept
+	if err := os.WriteFile(filepath.Join(outputDir, "com-example-windows.nix"), []byte("{ edited = true; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr = split(brokenSource{
+		MemorySource: plist.MemorySource{
+			"com.example.other":   "{\n    level = 1;\n}",
+			"com.example.windows": windows,
+		},
+		broken: []string{"com.apple.dock"},
+	}, "-filter", "state", "-prune")
+	for _, expected := range []string{
+		"Info: Removed 1 stale files: com-apple-Safari.nix",
+		"Warning: Leaving " + filepath.Join(outputDir, "com-example-windows.nix") + " alone, it was changed after defaults2nix wrote it",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected output to contain %q, got: %s", expected, stderr)
+		}
+	}
+	if exists("com-apple-Safari.nix") {
+		t.Error("Expected the stale file to be removed with -prune")
+	}
+	for _, file := range []string{"com-apple-dock.nix", "com-example-other.nix", "com-example-windows.nix", "mine.nix"} {
+		if !exists(file) {
+			t.Errorf("Expected %s to be kept", file)
+		}
+	}
+	m, err = readManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := m.entry("com.apple.dock"); entry.Status != statusReadError || entry.File != "com-apple-dock.nix" {
+		t.Errorf("Expected com.apple.dock to keep its file, got %+v", entry)
+	}
+	if len(m.Stale) != 0 {
+		t.Errorf("Expected no stale files after -prune, got %+v", m.Stale)
+	}
+}
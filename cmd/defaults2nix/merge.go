@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// mergeFile merges the converted defaults of domain into the Nix file at
+// path and returns the merged file.
+func mergeFile(path string, value plist.Value, domain string, config plist.Options) (plist.MergeResult, error) {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return plist.MergeResult{}, err
+	}
+	current, err := plist.Normalize(value, config)
+	if err != nil {
+		return plist.MergeResult{}, err
+	}
+	result, err := plist.MergeNix(string(existing), current, domain)
+	if err != nil {
+		return result, fmt.Errorf("%s: %v", path, err)
+	}
+
+	// Merged home directory paths need the function header in scope
+	if config.Home.Dir != "" && strings.Contains(result.Output, "${"+config.Home.Expr+"}") &&
+		!plist.HasFunctionHeader(string(existing)) {
+		result.Output = config.Home.Args + "\n" + result.Output
+	}
+	return result, nil
+}
+
+// reportMerge summarises a merge on w.
+func reportMerge(w io.Writer, path string, result plist.MergeResult) {
+	if len(result.Changed) > 0 {
+		fmt.Fprintf(w, "Info: Updated %d keys: %s\n", len(result.Changed), strings.Join(result.Changed, ", "))
+	}
+	if len(result.Added) > 0 {
+		fmt.Fprintf(w, "Info: Added %d keys: %s\n", len(result.Added), strings.Join(result.Added, ", "))
+	}
+	if len(result.Ignored) > 0 {
+		fmt.Fprintf(w, "Info: Ignoring %d keys deleted from %s: %s\n", len(result.Ignored), path, strings.Join(result.Ignored, ", "))
+	}
+	if len(result.Stale) > 0 {
+		fmt.Fprintf(w, "Info: Kept %d keys no longer in the defaults: %s\n", len(result.Stale), strings.Join(result.Stale, ", "))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestMergeFile_RespectsFilters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dock.nix")
+	if err := os.WriteFile(path, []byte("{\n  tilesize = 48;\n}\n# defaults2nix-known: [[\"tilesize\"]]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := plist.Options{NoState: true}
+	value, err := plist.Parse(strings.NewReader(`{ "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 "; tilesize = 64; }`), "com.apple.dock", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := mergeFile(path, value, "com.apple.dock", config)
+	if err != nil {
+		t.Fatalf("mergeFile() error = %v", err)
+	}
+	if strings.Contains(result.Output, "NSWindow") {
+		t.Errorf("Expected filtered keys to stay out of the merge, got:\n%s", result.Output)
+	}
+	if !strings.Contains(result.Output, "tilesize = 64;") {
+		t.Errorf("Expected changed value to be merged, got:\n%s", result.Output)
+	}
+}
+
+func TestCLI_MergeKeepsKeysDeletedFromGeneratedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dock.nix")
+	source := plist.MemorySource{"com.apple.dock": "{\n    autohide = 1;\n    tilesize = 48;\n}"}
+	if exitCode, _, stderr := runCLI(testEnv(source), "-out", path, "com.apple.dock"); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+
+	// Delete a key by hand
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(data), "  tilesize = 48;\n", "", 1)
+	if edited == string(data) {
+		t.Fatalf("Expected the generated file to hold tilesize, got:\n%s", data)
+	}
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first merge leaves the deleted key out, but adds new ones
+	source["com.apple.dock"] = "{\n    autohide = 1;\n    tilesize = 64;\n    orientation = left;\n}"
+	exitCode, _, stderr := runCLI(testEnv(source), "-merge", path, "com.apple.dock")
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	merged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(merged), "tilesize =") {
+		t.Errorf("Expected tilesize to stay deleted, got:\n%s", merged)
+	}
+	if !strings.Contains(string(merged), "orientation = \"left\";") {
+		t.Errorf("Expected orientation to be added, got:\n%s", merged)
+	}
+	if !strings.Contains(string(merged), "# defaults2nix-ignore: tilesize") {
+		t.Errorf("Expected tilesize on the ignore list, got:\n%s", merged)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// namingScheme turns domains into the names of the files -split writes.
+type namingScheme string
+
+const (
+	namingHyphens namingScheme = "hyphens" // com-apple-Safari.nix
+	namingDots    namingScheme = "dots"    // com.apple.Safari.nix
+	namingNested  namingScheme = "nested"  // com/apple/Safari.nix
+)
+
+// parseNaming returns the naming scheme called name, as accepted by the
+// -naming flag.
+func parseNaming(name string) (namingScheme, error) {
+	switch scheme := namingScheme(name); scheme {
+	case namingHyphens, namingDots, namingNested:
+		return scheme, nil
+	}
+	return "", fmt.Errorf("Unknown naming option '%s'. Valid options are: hyphens, dots, nested", name)
+}
+
+// filename returns the path of the file for domain, relative to the output
+// directory.
+func (n namingScheme) filename(domain string) string {
+	switch n {
+	case namingDots:
+		return sanitizePathComponent(domain) + ".nix"
+	case namingNested:
+		parts := strings.Split(strings.Trim(domain, "\""), ".")
+		for i, part := range parts {
+			parts[i] = sanitizePathComponent(part)
+		}
+		return filepath.Join(parts...) + ".nix"
+	}
+	return sanitizeFilename(domain) + ".nix"
+}
+
+// sanitizePathComponent makes a domain, or a part of one, safe to use as a
+// single file or directory name.
+func sanitizePathComponent(s string) string {
+	s = strings.Trim(s, "\"")
+	s = strings.ReplaceAll(s, " ", "_")
+	s = strings.ReplaceAll(s, "/", "_")
+	if s == "" || s == "." || s == ".." {
+		s = strings.Repeat("_", len(s)+1)
+	}
+	return s
+}
+
+// nameCollision is a file that several domains would be written to.
+type nameCollision struct {
+	file    string
+	domains []string
+}
+
+// findCollisions returns the files that more than one of domains map to
+// under n, in the order of domains. Names that only differ in case collide
+// too, since the default macOS file system ignores case.
+func findCollisions(domains []string, n namingScheme) []nameCollision {
+	groups := make(map[string]*nameCollision)
+	var order []string
+	for _, domain := range domains {
+		file := n.filename(domain)
+		key := strings.ToLower(file)
+		group, ok := groups[key]
+		if !ok {
+			group = &nameCollision{file: file}
+			groups[key] = group
+			order = append(order, key)
+		}
+		group.domains = append(group.domains, domain)
+	}
+
+	var collisions []nameCollision
+	for _, key := range order {
+		if len(groups[key].domains) > 1 {
+			collisions = append(collisions, *groups[key])
+		}
+	}
+	return collisions
+}
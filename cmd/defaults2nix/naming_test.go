@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestNamingScheme(t *testing.T) {
+	tests := []struct {
+		domain  string
+		hyphens string
+		dots    string
+		nested  string
+	}{
+		{"com.apple.Safari", "com-apple-Safari.nix", "com.apple.Safari.nix", "com/apple/Safari.nix"},
+		{"NSGlobalDomain", "NSGlobalDomain.nix", "NSGlobalDomain.nix", "NSGlobalDomain.nix"},
+		{`"com.example.my app"`, "com-example-my_app.nix", "com.example.my_app.nix", "com/example/my_app.nix"},
+		{"com.example..odd/name", "com-example--odd_name.nix", "com.example..odd_name.nix", "com/example/_/odd_name.nix"},
+	}
+	for _, tt := range tests {
+		for scheme, expected := range map[namingScheme]string{
+			namingHyphens: tt.hyphens,
+			namingDots:    tt.dots,
+			namingNested:  filepath.FromSlash(tt.nested),
+		} {
+			if got := scheme.filename(tt.domain); got != expected {
+				t.Errorf("%s.filename(%s) = %s, want %s", scheme, tt.domain, got, expected)
+			}
+		}
+	}
+
+	if _, err := parseNaming("flat"); err == nil || !strings.Contains(err.Error(), "Valid options are: hyphens, dots, nested") {
+		t.Errorf("Expected an unknown naming scheme to be rejected, got %v", err)
+	}
+}
+
+func TestFindCollisions(t *testing.T) {
+	domains := []string{"com.foo-bar", "com.apple.dock", "com.foo.bar", "com.Example.app", "com.example.app"}
+
+	collisions := findCollisions(domains, namingHyphens)
+	if len(collisions) != 2 {
+		t.Fatalf("Expected 2 collisions, got %+v", collisions)
+	}
+	if collisions[0].file != "com-foo-bar.nix" || strings.Join(collisions[0].domains, ",") != "com.foo-bar,com.foo.bar" {
+		t.Errorf("Expected com.foo-bar and com.foo.bar to collide, got %+v", collisions[0])
+	}
+	// Names that only differ in case collide on case-insensitive file systems
+	if strings.Join(collisions[1].domains, ",") != "com.Example.app,com.example.app" {
+		t.Errorf("Expected com.Example.app and com.example.app to collide, got %+v", collisions[1])
+	}
+
+	if collisions := findCollisions(domains, namingDots); len(collisions) != 1 {
+		t.Errorf("Expected only the case collision with dots, got %+v", collisions)
+	}
+}
+
+func TestSplitMode_Naming(t *testing.T) {
+	source := plist.MemorySource{
+		"com.apple.dock": cliDomains["com.apple.dock"],
+		"com.foo-bar":    "{\n    level = 1;\n}",
+		"com.foo.bar":    "{\n    level = 2;\n}",
+	}
+
+	// Colliding domains are errors and none of them is written
+	outputDir := t.TempDir()
+	exitCode, _, stderr := runCLI(testEnv(source), "-split", "-out", outputDir)
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for colliding domains, got %d", exitCode)
+	}
+	if !strings.Contains(stderr, "Error: Domains com.foo-bar, com.foo.bar would all be written to com-foo-bar.nix, so none of them is.") {
+		t.Errorf("Expected the collision to be reported, got: %s", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "com-foo-bar.nix")); err == nil {
+		t.Error("Expected no file to be written for colliding domains")
+	}
+	m, err := readManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := m.entry("com.foo.bar"); entry.Status != statusNameCollision {
+		t.Errorf("Expected com.foo.bar to be a name collision, got %s", entry.Status)
+	}
+
+	// Nested names keep the domains apart
+	exitCode, _, stderr = runCLI(testEnv(source), "-split", "-naming", "nested", "-prune", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	for _, file := range []string{"com/apple/dock.nix", "com/foo-bar.nix", "com/foo/bar.nix"} {
+		if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(file))); err != nil {
+			t.Errorf("Expected %s to be written: %v", file, err)
+		}
+	}
+	if !strings.Contains(stderr, "Info: Removed 1 stale files: com-apple-dock.nix") {
+		t.Errorf("Expected the file of the old naming scheme to be pruned, got: %s", stderr)
+	}
+
+	// Pruning the nested files removes the directories they leave empty
+	exitCode, _, stderr = runCLI(testEnv(source), "-split", "-naming", "dots", "-prune", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "com")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty nested directories to be removed, got %v", err)
+	}
+	for _, file := range []string{"com.apple.dock.nix", "com.foo-bar.nix", "com.foo.bar.nix"} {
+		if _, err := os.Stat(filepath.Join(outputDir, file)); err != nil {
+			t.Errorf("Expected %s to be written: %v", file, err)
+		}
+	}
+}
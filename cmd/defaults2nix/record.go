@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// recording is the result of comparing two snapshots of all domains.
+type recording struct {
+	Value   plist.Value // Keys added or changed in the second snapshot, keyed by domain
+	Changed []string    // Key paths that were added or changed
+	Removed []string    // Key paths only found in the first snapshot
+}
+
+// recordChanges compares two snapshots of `defaults read` for all domains
+// and keeps the keys that were added or changed between them, with their
+// new value. Filters and selection queries apply to both snapshots, so that
+// keys such as timestamps that change on their own can be left out.
+func recordChanges(before, after []byte, config plist.Options, queries []plist.SelectQuery) (recording, error) {
+	var result recording
+	var values []plist.Value
+	for _, snapshot := range [][]byte{before, after} {
+		converted, err := plist.ConvertDomain(strings.NewReader(string(snapshot)), "", config, queries)
+		if err != nil {
+			return result, err
+		}
+		normalized, err := plist.Normalize(converted.Value, config)
+		if err != nil {
+			return result, err
+		}
+		values = append(values, normalized)
+	}
+
+	var paths [][]string
+	for _, c := range plist.Diff(values[0], values[1]) {
+		if c.Kind == plist.ChangeRemoved {
+			result.Removed = append(result.Removed, plist.FormatDomainPath("", c.Path))
+			continue
+		}
+		paths = append(paths, c.Path)
+		result.Changed = append(result.Changed, plist.FormatDomainPath("", c.Path))
+	}
+
+	result.Value = plist.DictValue{Values: make(map[string]plist.Value), Order: []string{}}
+	if len(paths) > 0 {
+		if selected, ok := plist.SelectPaths(values[1], paths); ok {
+			result.Value = selected
+		}
+	}
+	return result, nil
+}
+
+// waitForEnter blocks until a line is read from stdin, stdin is closed or
+// ctx is done.
+func waitForEnter(ctx context.Context, stdin io.Reader) {
+	done := make(chan struct{})
+	go func() {
+		bufio.NewReader(stdin).ReadString('\n')
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// runRecord implements `defaults2nix record`. It takes a snapshot of all
+// domains, waits for Enter or a signal, takes a second snapshot and prints
+// the keys that changed in between.
+func runRecord(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env environment) int {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: defaults2nix record [flags]\n\n")
+		fmt.Fprintf(stderr, "Record which defaults change while you change a setting.\n")
+		fmt.Fprintf(stderr, "Takes a snapshot of all domains, waits for Enter or Ctrl-C, takes another\n")
+		fmt.Fprintf(stderr, "snapshot and prints the keys that changed, grouped by domain.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  defaults2nix record -filter dates,state,usage\n")
+		fmt.Fprintf(stderr, "  defaults2nix record -i before.txt -i after.txt\n")
+	}
+	conv := addConversionFlags(fs)
+	out := fs.String("out", "", "Output file path")
+	var inputs stringList
+	fs.Var(&inputs, "i", "Compare two `file`s holding `defaults read` output instead of taking snapshots (give twice)")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 1
+	}
+	if len(inputs) != 0 && len(inputs) != 2 {
+		fmt.Fprintf(stderr, "Error: -i must be given twice, for the snapshots before and after.\n")
+		return 1
+	}
+
+	config, queries, err := conv.parse(env.getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var snapshots [][]byte
+	if len(inputs) > 0 {
+		snapshots, err = readInputs(inputs, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+			return 1
+		}
+	} else {
+		if env.goos != "darwin" {
+			fmt.Fprintf(stderr, "Error: Taking snapshots requires macOS, use -i to compare saved dumps.\n")
+			return 1
+		}
+		before, err := env.source.Read(ctx, "")
+		if err != nil {
+			fmt.Fprintf(stderr, "Error executing 'defaults read': %v\n", err)
+			return 1
+		}
+
+		waitCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		fmt.Fprintf(stderr, "Recording. Change the settings now, then press Enter (or Ctrl-C) to finish.\n")
+		waitForEnter(waitCtx, stdin)
+		stop()
+
+		after, err := env.source.Read(ctx, "")
+		if err != nil {
+			fmt.Fprintf(stderr, "Error executing 'defaults read': %v\n", err)
+			return 1
+		}
+		snapshots = [][]byte{before, after}
+	}
+
+	recorded, err := recordChanges(snapshots[0], snapshots[1], config, queries)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error converting defaults: %v\n", err)
+		return 1
+	}
+
+	if len(recorded.Changed) == 0 {
+		fmt.Fprintf(stderr, "Info: No keys changed.\n")
+	} else {
+		fmt.Fprintf(stderr, "Info: %d keys changed: %s\n", len(recorded.Changed), strings.Join(recorded.Changed, ", "))
+	}
+	if len(recorded.Removed) > 0 {
+		fmt.Fprintf(stderr, "Info: %d keys were removed: %s\n", len(recorded.Removed), strings.Join(recorded.Removed, ", "))
+	}
+
+	result := renderNix(recorded.Value, config)
+	if *out != "" {
+		if err := writeFileAtomic(*out, []byte(result), 0644); err != nil {
+			fmt.Fprintf(stderr, "Error writing to file %s: %v\n", *out, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintln(stdout, result)
+	return 0
+}
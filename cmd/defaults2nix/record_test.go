@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+var recordBefore = `{
+    "com.apple.dock" = {
+        autohide = 0;
+        "last-messagetrace-stamp" = "2025-06-07 12:01:44 +0000";
+        tilesize = 48;
+    };
+    "com.apple.finder" = {
+        AppleShowAllFiles = 0;
+        FXPreferredViewStyle = icnv;
+    };
+    NSGlobalDomain = {
+        AppleInterfaceStyle = Dark;
+        NSTableViewDefaultSizeMode = 2;
+    };
+}`
+
+var recordAfter = `{
+    "com.apple.dock" = {
+        autohide = 1;
+        "last-messagetrace-stamp" = "2025-06-07 12:05:10 +0000";
+        tilesize = 48;
+    };
+    "com.apple.finder" = {
+        AppleShowAllFiles = 1;
+        ShowExternalHardDrivesOnDesktop = 1;
+        FXPreferredViewStyle = icnv;
+    };
+    NSGlobalDomain = {
+        NSTableViewDefaultSizeMode = 2;
+    };
+}`
+
+func TestRecordChanges(t *testing.T) {
+	recorded, err := recordChanges([]byte(recordBefore), []byte(recordAfter), plist.Options{NoDates: true}, nil)
+	if err != nil {
+		t.Fatalf("recordChanges() error = %v", err)
+	}
+
+	expected := `{
+  "com.apple.dock" = {
+    autohide = true;
+  };
+  "com.apple.finder" = {
+    AppleShowAllFiles = true;
+    ShowExternalHardDrivesOnDesktop = true;
+  };
+}`
+	if result := recorded.Value.ToNix(0); result != expected {
+		t.Errorf("recordChanges() =\n%s\nwant\n%s", result, expected)
+	}
+
+	changed := []string{"com.apple.dock:autohide", "com.apple.finder:AppleShowAllFiles", "com.apple.finder:ShowExternalHardDrivesOnDesktop"}
+	if strings.Join(recorded.Changed, ",") != strings.Join(changed, ",") {
+		t.Errorf("Changed = %v, want %v", recorded.Changed, changed)
+	}
+	if strings.Join(recorded.Removed, ",") != "NSGlobalDomain:AppleInterfaceStyle" {
+		t.Errorf("Removed = %v, want [NSGlobalDomain:AppleInterfaceStyle]", recorded.Removed)
+	}
+}
+
+func TestRecordChanges_WithoutFilters(t *testing.T) {
+	recorded, err := recordChanges([]byte(recordBefore), []byte(recordAfter), plist.Options{}, nil)
+	if err != nil {
+		t.Fatalf("recordChanges() error = %v", err)
+	}
+	if !strings.Contains(recorded.Value.ToNix(0), "last-messagetrace-stamp") {
+		t.Errorf("Expected changed timestamp without -filter dates, got:\n%s", recorded.Value.ToNix(0))
+	}
+}
+
+func TestRecordChanges_NoChanges(t *testing.T) {
+	recorded, err := recordChanges([]byte(recordBefore), []byte(recordBefore), plist.Options{}, nil)
+	if err != nil {
+		t.Fatalf("recordChanges() error = %v", err)
+	}
+	if result := recorded.Value.ToNix(0); result != "{}" {
+		t.Errorf("Expected empty attrset, got:\n%s", result)
+	}
+}
+
+func TestRunRecord_SavedDumps(t *testing.T) {
+	dir := t.TempDir()
+	before := filepath.Join(dir, "before.txt")
+	after := filepath.Join(dir, "after.txt")
+	if err := os.WriteFile(before, []byte(recordBefore), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(after, []byte(recordAfter), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runRecord(context.Background(), []string{"-filter", "dates", "-select", "com.apple.dock:*", "-i", before, "-i", after}, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{}))
+	if code != 0 {
+		t.Fatalf("runRecord() = %d, stderr: %s", code, stderr.String())
+	}
+	if expected := "{\n  \"com.apple.dock\" = {\n    autohide = true;\n  };\n}\n"; stdout.String() != expected {
+		t.Errorf("runRecord() output =\n%s\nwant\n%s", stdout.String(), expected)
+	}
+	if !strings.Contains(stderr.String(), "Info: 1 keys changed: com.apple.dock:autohide") {
+		t.Errorf("Expected summary on stderr, got: %s", stderr.String())
+	}
+}
+
+func TestRunRecord_InputCount(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runRecord(context.Background(), []string{"-i", "before.txt"}, strings.NewReader(""), &stdout, &stderr, testEnv(plist.MemorySource{})); code != 1 {
+		t.Errorf("runRecord() = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "-i must be given twice") {
+		t.Errorf("Unexpected stderr: %s", stderr.String())
+	}
+}
+
+func TestWaitForEnter(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		waitForEnter(context.Background(), strings.NewReader("\n"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waitForEnter() did not return after Enter")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	waitForEnter(ctx, r) // Returns once the context is done
+}
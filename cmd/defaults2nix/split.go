@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// forEach calls fn with every index below n, running at most jobs calls at
+// the same time, and returns once all of them have returned. Indices are
+// started in order, so with a single job fn is called for each in turn.
+func forEach(n, jobs int, fn func(i int)) {
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range min(max(jobs, 1), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < n; i = int(next.Add(1)) - 1 {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// splitResult is the outcome of reading and converting a single domain for
+// -split.
+type splitResult struct {
+	domain    string
+	status    domainStatus // Empty until the file is written
+	samples   [][]byte
+	converted plist.Conversion
+	nix       string // Rendered file contents
+	keys      int    // Number of top level keys in nix
+	err       error  // Reading or converting the domain failed, or ctx was done first
+}
+
+// splitter reads and converts domains for -split, and reads them when
+// several domains are converted into a single file.
+type splitter struct {
+	source   plist.DefaultsSource
+	config   plist.Options
+	queries  []plist.SelectQuery
+	samples  int           // Number of times each domain is read
+	interval time.Duration // Time between sampling rounds
+	timeout  time.Duration // Time after which reading a domain is given up
+	jobs     int           // Number of domains read or converted at the same time
+}
+
+// read reads every domain s.samples times, at most s.jobs at a time, and
+// returns the results in the order of domains. Every domain is read once
+// per sampling round, so that the interval applies between rounds rather
+// than between domains. Once ctx is done, the domains that weren't read
+// yet fail with the error of ctx.
+func (s *splitter) read(ctx context.Context, domains []string) []splitResult {
+	results := make([]splitResult, len(domains))
+	for i, domain := range domains {
+		results[i].domain = domain
+	}
+
+	for round := 0; round < s.samples; round++ {
+		if round > 0 && sleep(ctx, s.interval) != nil {
+			break
+		}
+		forEach(len(results), s.jobs, func(i int) {
+			r := &results[i]
+			if r.err != nil {
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				r.err = err
+				return
+			}
+			output, err := readDomain(ctx, s.source, r.domain, s.timeout)
+			if err != nil {
+				r.err = err
+				return
+			}
+			r.samples = append(r.samples, output)
+		})
+	}
+	// Domains that missed a round were cut short by ctx
+	for i := range results {
+		if r := &results[i]; r.err == nil && len(r.samples) < s.samples {
+			r.err = ctx.Err()
+		}
+	}
+	return results
+}
+
+// convert reads and converts every domain, at most s.jobs at a time, and
+// returns the results in the order of domains, with the status of those
+// that have nothing to write.
+func (s *splitter) convert(ctx context.Context, domains []string) []splitResult {
+	results := s.read(ctx, domains)
+	forEach(len(results), s.jobs, func(i int) {
+		r := &results[i]
+		switch {
+		case errors.Is(r.err, errReadTimeout):
+			r.status = statusTimedOut
+		case errors.Is(r.err, context.Canceled) || errors.Is(r.err, context.DeadlineExceeded):
+			r.status = statusUnfinished
+		case r.err != nil:
+			r.status = statusReadError
+		default:
+			s.convertResult(r)
+		}
+		r.samples = nil
+	})
+	return results
+}
+
+// convertResult converts the samples of a domain that was read, setting
+// its status when there is nothing to write.
+func (s *splitter) convertResult(r *splitResult) {
+	r.converted, r.err = plist.ConvertSamples(r.samples, r.domain, s.config, s.queries)
+	if _, ok := r.converted.Value.(plist.DictValue); r.err == nil && !ok {
+		r.err = errors.New("defaults output is not a dictionary")
+	}
+	if r.err != nil {
+		r.status = statusParseError
+		return
+	}
+	r.nix = renderFile(r.converted.Value, s.config)
+	// Count what is left once the filters applied while rendering have run
+	r.keys = keyCount(r.converted.Value)
+	if written, err := plist.ParseNix(r.nix); err == nil {
+		r.keys = keyCount(written)
+	}
+	if r.keys > 0 {
+		return
+	}
+	r.status = statusEmpty
+	// Tell domains without keys from those whose keys were all filtered out
+	raw, err := plist.Parse(bytes.NewReader(r.samples[len(r.samples)-1]), r.domain, plist.Options{})
+	if err == nil && keyCount(raw) > 0 {
+		r.status = statusFilteredEmpty
+	}
+}
+
+// collectStale finds the files previous records as written by defaults2nix
+// that m no longer refers to, because their domain is gone, has nothing
+// left to write or is written to another file. With prune, these files are
+// removed and returned, otherwise they are kept in m.Stale. Files that were
+// changed since defaults2nix wrote them are left alone and forgotten.
+func (m *manifest) collectStale(dir string, previous manifest, prune bool, warn func(format string, args ...any)) []string {
+	current := make(map[string]bool)
+	for _, e := range m.Domains {
+		if e.File != "" {
+			current[e.File] = true
+		}
+	}
+	if m.Index != nil {
+		current[m.Index.File] = true
+	}
+	owned := previous.owned()
+	names := make([]string, 0, len(owned))
+	for name := range owned {
+		if !current[name] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var removed []string
+	for _, name := range names {
+		f := owned[name]
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			warn("Warning: Failed to read %s: %v\n", path, err)
+			m.Stale = append(m.Stale, f)
+			continue
+		}
+		if contentHash(string(data)) != f.SHA256 {
+			warn("Warning: Leaving %s alone, it was changed after defaults2nix wrote it\n", path)
+			continue
+		}
+		if !prune {
+			m.Stale = append(m.Stale, f)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			warn("Warning: Failed to remove %s: %v\n", path, err)
+			m.Stale = append(m.Stale, f)
+			continue
+		}
+		removeEmptyDirs(dir, filepath.Dir(path))
+		removed = append(removed, name)
+	}
+	return removed
+}
+
+// removeEmptyDirs removes path and its parents up to dir, stopping at the
+// first one that isn't empty. It cleans up after -naming nested.
+func removeEmptyDirs(dir, path string) {
+	dir = filepath.Clean(dir)
+	for path != dir && strings.HasPrefix(path, dir) {
+		if os.Remove(path) != nil {
+			return
+		}
+		path = filepath.Dir(path)
+	}
+}
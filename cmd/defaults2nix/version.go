@@ -0,0 +1,23 @@
+package main
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// version is the version of defaults2nix, set at build time with
+// -ldflags "-X main.version=$(cat version.txt)".
+var version string
+
+// toolVersion returns the version of defaults2nix. Builds without the
+// version set fall back to the module version recorded by `go install`,
+// or to "dev".
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return strings.TrimPrefix(info.Main.Version, "v")
+	}
+	return "dev"
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// watchEvent is a key that changed between two polls.
+type watchEvent struct {
+	Time   time.Time
+	Domain string
+	Change plist.Change
+}
+
+// formatNix renders the event as a Nix assignment that can be pasted into a
+// configuration, with the time as a trailing comment. Removed keys are
+// written as a comment, since there is no value to assign.
+func (e watchEvent) formatNix() string {
+	path := plist.NixAttrPath(append([]string{e.Domain}, e.Change.Path...))
+	timestamp := e.Time.Format(time.RFC3339)
+	if e.Change.Kind == plist.ChangeRemoved {
+		return fmt.Sprintf("# %s removed at %s", path, timestamp)
+	}
+	return fmt.Sprintf("%s = %s; # %s", path, plist.InlineNix(e.Change.New), timestamp)
+}
+
+// formatJSON renders the event as a single line of JSON. The old and new
+// values are left out when the key was added or removed.
+func (e watchEvent) formatJSON() (string, error) {
+	event := struct {
+		Time   string           `json:"time"`
+		Kind   plist.ChangeKind `json:"kind"`
+		Domain string           `json:"domain"`
+		Key    string           `json:"key"`
+		Path   []string         `json:"path"`
+		Old    json.RawMessage  `json:"old,omitempty"`
+		New    json.RawMessage  `json:"new,omitempty"`
+	}{
+		Time:   e.Time.Format(time.RFC3339),
+		Kind:   e.Change.Kind,
+		Domain: e.Domain,
+		Key:    plist.FormatKeyPath(e.Change.Path),
+		Path:   e.Change.Path,
+	}
+	var err error
+	if e.Change.Old != nil {
+		if event.Old, err = plist.EncodeJSON(e.Change.Old); err != nil {
+			return "", err
+		}
+	}
+	if e.Change.New != nil {
+		if event.New, err = plist.EncodeJSON(e.Change.New); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(event)
+	return string(data), err
+}
+
+// watcher polls domains and reports the keys that change between polls.
+type watcher struct {
+	source  plist.DefaultsSource
+	domains []string // Domains to watch, all domains in a single read when empty
+	config  plist.Options
+	queries []plist.SelectQuery
+	jobs    int              // Number of domains read at the same time
+	now     func() time.Time // Clock for event times
+	warn    func(format string, args ...any)
+
+	last    map[string]plist.Value // Value of each domain at the previous poll
+	failing map[string]bool        // Domains whose last read failed, to warn only once
+}
+
+// poll reads every watched domain once, at most w.jobs at a time, and
+// returns the changes since the previous poll in the order of w.domains.
+// The first poll only records the current values. A domain that can't be
+// read keeps its previous value.
+func (w *watcher) poll(ctx context.Context) []watchEvent {
+	if w.last == nil {
+		w.last = make(map[string]plist.Value)
+		w.failing = make(map[string]bool)
+	}
+
+	domains := w.domains
+	if len(domains) == 0 {
+		domains = []string{""}
+	}
+	values := make([]plist.Value, len(domains))
+	errs := make([]error, len(domains))
+
+	forEach(len(domains), w.jobs, func(i int) {
+		values[i], errs[i] = w.read(ctx, domains[i])
+	})
+
+	now := w.now()
+	var events []watchEvent
+	for i, domain := range domains {
+		if errs[i] != nil {
+			if ctx.Err() == nil && !w.failing[domain] {
+				w.warn("Warning: Failed to read domain %s: %v\n", displayDomain(domain), errs[i])
+			}
+			w.failing[domain] = true
+			continue
+		}
+		w.failing[domain] = false
+
+		previous, seen := w.last[domain]
+		w.last[domain] = values[i]
+		if !seen {
+			continue
+		}
+		for _, c := range plist.Diff(previous, values[i]) {
+			event := watchEvent{Time: now, Domain: domain, Change: c}
+			if domain == "" {
+				// Reading all domains puts the domain first in the path
+				if len(c.Path) == 0 {
+					continue
+				}
+				event.Domain, event.Change.Path = c.Path[0], c.Path[1:]
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// read reads and converts a domain, normalized so that filtered keys and
+// formatting differences don't show up as changes.
+func (w *watcher) read(ctx context.Context, domain string) (plist.Value, error) {
+	output, err := w.source.Read(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := plist.ConvertDomain(strings.NewReader(string(output)), domain, w.config, w.queries)
+	if err != nil {
+		return nil, err
+	}
+	return plist.Normalize(converted.Value, w.config)
+}
+
+func displayDomain(domain string) string {
+	if domain == "" {
+		return "(all domains)"
+	}
+	return domain
+}
+
+// runWatch implements `defaults2nix watch`. It polls the given domains, or
+// all domains, and prints every key that changes until interrupted.
+func runWatch(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env environment) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: defaults2nix watch [flags] [domains...]\n\n")
+		fmt.Fprintf(stderr, "Print every key that changes in the given domains, or in all domains, as a\n")
+		fmt.Fprintf(stderr, "Nix assignment or a JSON event, until interrupted.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  defaults2nix watch com.apple.dock com.apple.finder\n")
+		fmt.Fprintf(stderr, "  defaults2nix watch -filter dates,state,usage -interval 1s\n")
+		fmt.Fprintf(stderr, "  defaults2nix watch -json NSGlobalDomain > changes.jsonl\n")
+	}
+	conv := addConversionFlags(fs)
+	interval := fs.Duration("interval", 2*time.Second, "Time to wait between polls")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Number of domains to read at the same time")
+	jsonOutput := fs.Bool("json", false, "Print changes as JSON events, one per line")
+	count := fs.Int("count", 0, "Stop after this many polls (0 watches until interrupted)")
+	domains, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 1
+	}
+	if *interval <= 0 {
+		fmt.Fprintf(stderr, "Error: -interval must be positive.\n")
+		return 1
+	}
+	if *jobs < 1 {
+		fmt.Fprintf(stderr, "Error: -jobs must be at least 1.\n")
+		return 1
+	}
+
+	config, queries, err := conv.parse(env.getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	w := &watcher{
+		source:  env.source,
+		domains: domains,
+		config:  config,
+		queries: queries,
+		jobs:    *jobs,
+		now:     time.Now,
+		warn:    func(format string, args ...any) { fmt.Fprintf(stderr, format, args...) },
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(w.domains) == 0 {
+		fmt.Fprintf(stderr, "Watching all domains every %s, press Ctrl-C to stop.\n", *interval)
+	} else {
+		fmt.Fprintf(stderr, "Watching %s every %s, press Ctrl-C to stop.\n", strings.Join(w.domains, ", "), *interval)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for polls := 1; ; polls++ {
+		for _, event := range w.poll(ctx) {
+			if !*jsonOutput {
+				fmt.Fprintln(stdout, event.formatNix())
+				continue
+			}
+			line, err := event.formatJSON()
+			if err != nil {
+				fmt.Fprintf(stderr, "Error encoding event: %v\n", err)
+				return 1
+			}
+			fmt.Fprintln(stdout, line)
+		}
+		if *count > 0 && polls >= *count {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+// fakeDefaults returns canned `defaults read` output. Each read of a domain
+// returns the next output in its list, repeating the last one.
+type fakeDefaults struct {
+	plist.MemorySource
+	mu      sync.Mutex
+	outputs map[string][]string
+	reads   map[string]int
+}
+
+func (f *fakeDefaults) Read(ctx context.Context, domain string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	outputs, ok := f.outputs[domain]
+	if !ok {
+		return nil, fmt.Errorf("domain %s does not exist", domain)
+	}
+	if f.reads == nil {
+		f.reads = make(map[string]int)
+	}
+	i := min(f.reads[domain], len(outputs)-1)
+	f.reads[domain]++
+	return []byte(outputs[i]), nil
+}
+
+var watchTime = time.Date(2025, 6, 7, 12, 1, 44, 0, time.UTC)
+
+func newTestWatcher(source plist.DefaultsSource, domains ...string) (*watcher, *bytes.Buffer) {
+	var warnings bytes.Buffer
+	return &watcher{
+		source:  source,
+		domains: domains,
+		jobs:    2,
+		now:     func() time.Time { return watchTime },
+		warn:    func(format string, args ...any) { fmt.Fprintf(&warnings, format, args...) },
+	}, &warnings
+}
+
+func formatEvents(events []watchEvent) string {
+	var lines []string
+	for _, e := range events {
+		lines = append(lines, e.formatNix())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestWatcherPoll(t *testing.T) {
+	source := &fakeDefaults{outputs: map[string][]string{
+		"com.apple.dock": {
+			`{ autohide = 0; orientation = bottom; }`,
+			`{ autohide = 1; orientation = bottom; }`,
+			`{ autohide = 1; }`,
+		},
+		"com.apple.finder": {
+			`{ ShowPathbar = 0; }`,
+			`{ ShowPathbar = 0; "NewWindowTarget" = PfHm; }`,
+		},
+	}}
+	w, warnings := newTestWatcher(source, "com.apple.dock", "com.apple.finder", "com.example.missing")
+
+	if events := w.poll(context.Background()); len(events) != 0 {
+		t.Errorf("First poll should only record values, got:\n%s", formatEvents(events))
+	}
+	if !strings.Contains(warnings.String(), "Warning: Failed to read domain com.example.missing") {
+		t.Errorf("Expected warning for missing domain, got: %s", warnings.String())
+	}
+
+	expected := "\"com.apple.dock\".autohide = true; # 2025-06-07T12:01:44Z\n" +
+		"\"com.apple.finder\".NewWindowTarget = \"PfHm\"; # 2025-06-07T12:01:44Z"
+	if result := formatEvents(w.poll(context.Background())); result != expected {
+		t.Errorf("Second poll =\n%s\nwant\n%s", result, expected)
+	}
+
+	expected = "# \"com.apple.dock\".orientation removed at 2025-06-07T12:01:44Z"
+	if result := formatEvents(w.poll(context.Background())); result != expected {
+		t.Errorf("Third poll =\n%s\nwant\n%s", result, expected)
+	}
+
+	if events := w.poll(context.Background()); len(events) != 0 {
+		t.Errorf("Expected no changes, got:\n%s", formatEvents(events))
+	}
+	if strings.Count(warnings.String(), "Warning") != 1 {
+		t.Errorf("Expected a single warning for the missing domain, got: %s", warnings.String())
+	}
+}
+
+func TestWatcherPoll_AllDomains(t *testing.T) {
+	source := &fakeDefaults{outputs: map[string][]string{
+		"": {
+			`{ "com.apple.dock" = { autohide = 0; }; NSGlobalDomain = { AppleLocale = "en_US"; }; }`,
+			`{ "com.apple.dock" = { autohide = 0; }; NSGlobalDomain = { AppleLocale = "en_GB"; }; }`,
+		},
+	}}
+	w, _ := newTestWatcher(source)
+	w.poll(context.Background())
+
+	events := w.poll(context.Background())
+	if len(events) != 1 || events[0].Domain != "NSGlobalDomain" {
+		t.Fatalf("Expected one change in NSGlobalDomain, got:\n%s", formatEvents(events))
+	}
+	line, err := events[0].formatJSON()
+	if err != nil {
+		t.Fatalf("formatJSON() error = %v", err)
+	}
+	expected := `{"time":"2025-06-07T12:01:44Z","kind":"changed","domain":"NSGlobalDomain","key":"AppleLocale","path":["AppleLocale"],"old":"en_US","new":"en_GB"}`
+	if line != expected {
+		t.Errorf("formatJSON() =\n%s\nwant\n%s", line, expected)
+	}
+}
+
+func TestWatcherPoll_Filters(t *testing.T) {
+	source := &fakeDefaults{outputs: map[string][]string{
+		"com.apple.dock": {
+			`{ autohide = 0; "last-messagetrace-stamp" = "2025-06-07 12:01:44 +0000"; }`,
+			`{ autohide = 0; "last-messagetrace-stamp" = "2025-06-07 12:05:10 +0000"; }`,
+		},
+	}}
+	w, _ := newTestWatcher(source, "com.apple.dock")
+	w.config = plist.Options{NoDates: true}
+	w.poll(context.Background())
+	if events := w.poll(context.Background()); len(events) != 0 {
+		t.Errorf("Expected filtered keys to be ignored, got:\n%s", formatEvents(events))
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	source := &fakeDefaults{outputs: map[string][]string{
+		"com.apple.dock": {`{ tilesize = 48; }`, `{ tilesize = 64; }`},
+	}}
+	var stdout, stderr bytes.Buffer
+	code := runWatch(context.Background(), []string{"-json", "-interval", "1ms", "-count", "2", "com.apple.dock"}, strings.NewReader(""), &stdout, &stderr, testEnv(source))
+	if code != 0 {
+		t.Fatalf("runWatch() = %d, stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"domain":"com.apple.dock","key":"tilesize","path":["tilesize"],"old":48,"new":64}`) {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
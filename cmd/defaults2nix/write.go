@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to the file at path through a temporary file
+// in the same directory, which is renamed over path once it is complete.
+// An interrupted write leaves the previous file as it was rather than half
+// written. An existing file keeps its permissions, new files get perm.
+// Symbolic links are followed, and devices such as /dev/stdout are written
+// to directly.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		if !info.Mode().IsRegular() {
+			return os.WriteFile(path, data, perm)
+		}
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing the temporary file fails harmlessly once it was renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeIfChanged writes content to the file at path unless the file
+// already holds it, so that its modification time only changes along with
+// its contents. It reports whether the file was written.
+func writeIfChanged(path, content string) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && contentHash(string(existing)) == contentHash(content) {
+		return false, nil
+	}
+	return true, writeFileAtomic(path, []byte(content), 0644)
+}
+
+// overwritePolicy decides which existing files -split may replace.
+type overwritePolicy int
+
+const (
+	overwriteOwned  overwritePolicy = iota // Files defaults2nix wrote that weren't edited since
+	overwriteNever                         // No existing files, with -no-clobber
+	overwriteAlways                        // Any file, with -force
+)
+
+// mayOverwrite reports whether the file at path may be replaced with
+// content under policy. owned holds the files the previous run wrote, by
+// path relative to dir. Files that don't exist yet or already hold content
+// may always be written.
+func mayOverwrite(dir, path, content string, policy overwritePolicy, owned map[string]staleFile) bool {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return os.IsNotExist(err) || policy == overwriteAlways
+	}
+	hash := contentHash(string(existing))
+	if hash == contentHash(content) {
+		return true
+	}
+	switch policy {
+	case overwriteAlways:
+		return true
+	case overwriteOwned:
+		name, err := filepath.Rel(dir, path)
+		return err == nil && owned[name].SHA256 == hash
+	}
+	return false
+}
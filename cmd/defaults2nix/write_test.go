@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dock.nix")
+
+	if err := writeFileAtomic(path, []byte("{ a = 1; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("{ a = 2; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{ a = 2; }" {
+		t.Errorf("Expected the new contents, got %s", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file to keep its permissions, got %v", info.Mode())
+	}
+
+	// Writing through a symbolic link replaces the file it points to
+	link := filepath.Join(dir, "link.nix")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(link, []byte("{ a = 3; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to stay a symbolic link", link)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{ a = 3; }" {
+		t.Errorf("Expected the link target to be written, got %s", data)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("Expected no temporary files to be left, found %s", entry.Name())
+		}
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "dock.nix"), nil, 0644); err == nil {
+		t.Error("Expected writing into a missing directory to fail")
+	}
+}
+
+func TestSplitMode_OverwritePolicy(t *testing.T) {
+	outputDir := t.TempDir()
+	dockFile := filepath.Join(outputDir, "com-apple-dock.nix")
+	safariFile := filepath.Join(outputDir, "com-apple-Safari.nix")
+	handWritten := "{ tilesize = 64; }\n"
+	if err := os.WriteFile(dockFile, []byte(handWritten), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// Files defaults2nix didn't write are left alone
+	exitCode, _, stderr := runCLI(testEnv(cliDomains), "-split", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if !strings.Contains(stderr, "Warning: Left 1 existing files alone that defaults2nix didn't write or that were edited, use -force to overwrite them: com-apple-dock.nix") {
+		t.Errorf("Expected the kept file to be reported, got: %s", stderr)
+	}
+	if read(dockFile) != handWritten {
+		t.Error("Expected the hand written file to be kept")
+	}
+	m, err := readManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := m.entry("com.apple.dock"); entry.Status != statusKept {
+		t.Errorf("Expected com.apple.dock to be kept, got %s", entry.Status)
+	}
+
+	// -no-clobber doesn't even replace the files defaults2nix wrote
+	source := plist.MemorySource{
+		"com.apple.Safari": `{ HomePage = "https://example.org"; }`,
+		"com.apple.dock":   cliDomains["com.apple.dock"],
+	}
+	safari := read(safariFile)
+	exitCode, _, stderr = runCLI(testEnv(source), "-split", "-no-clobber", "-out", outputDir)
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 when every file is kept, got %d", exitCode)
+	}
+	if !strings.Contains(stderr, "Info: Left 2 existing files alone because of -no-clobber: com-apple-Safari.nix, com-apple-dock.nix") {
+		t.Errorf("Expected the kept files to be reported, got: %s", stderr)
+	}
+	if read(safariFile) != safari {
+		t.Error("Expected -no-clobber to keep the file")
+	}
+
+	// -force overwrites everything
+	exitCode, _, stderr = runCLI(testEnv(source), "-split", "-force", "-out", outputDir)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr)
+	}
+	if read(dockFile) == handWritten || !strings.Contains(read(safariFile), "example.org") {
+		t.Error("Expected -force to overwrite the files")
+	}
+
+	// A single -out file is only refused with -no-clobber
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "-no-clobber", "-out", dockFile, "com.apple.dock")
+	if exitCode != 1 || !strings.Contains(stderr, "already exists and -no-clobber is set") {
+		t.Errorf("Expected -no-clobber to refuse an existing -out file, got exit code %d: %s", exitCode, stderr)
+	}
+	if exitCode, _, stderr := runCLI(testEnv(cliDomains), "-out", dockFile, "com.apple.dock"); exitCode != 0 {
+		t.Errorf("Expected an existing -out file to be overwritten, got exit code %d: %s", exitCode, stderr)
+	}
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "-force", "-out", dockFile, "com.apple.dock")
+	if exitCode != 1 || !strings.Contains(stderr, "Error: -force requires -split") {
+		t.Errorf("Expected -force without -split to be rejected, got exit code %d: %s", exitCode, stderr)
+	}
+
+	exitCode, _, stderr = runCLI(testEnv(cliDomains), "-split", "-force", "-no-clobber", "-out", outputDir)
+	if exitCode != 1 || !strings.Contains(stderr, "Cannot use -no-clobber and -force at the same time") {
+		t.Errorf("Expected -force and -no-clobber to be rejected together, got exit code %d: %s", exitCode, stderr)
+	}
+}
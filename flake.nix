@@ -18,6 +18,8 @@
             version = mod.version;
             hash = mod.bin-hash;
             vendorHash = null;
+            subPackages = ["cmd/defaults2nix"];
+            ldflags = ["-X main.version=${mod.version}"];
             doCheck = false;
           };
       in {
@@ -1,3 +1,3 @@
-module defaults2nix
+module github.com/joshryandavis/defaults2nix
 
 go 1.24.3
@@ -0,0 +1,27 @@
+package plist
+
+// stripBaseline leaves out the keys of value, the defaults of domain or of
+// all domains when domain is empty, whose value equals the one in
+// config.Baseline. Keys missing from the baseline are kept. Values are
+// compared like Diff does, so arrays are kept whole when any element
+// differs.
+func stripBaseline(value Value, domain string, config Options) Value {
+	baseline := config.Baseline
+	if domain != "" {
+		var ok bool
+		if baseline, ok = ValueAt(baseline, []string{domain}); !ok {
+			return value
+		}
+	}
+
+	var paths [][]string
+	for _, c := range Diff(baseline, value) {
+		if c.Kind != ChangeRemoved {
+			paths = append(paths, c.Path)
+		}
+	}
+	if selected, ok := SelectPaths(value, paths); ok {
+		return selected
+	}
+	return DictValue{Values: make(map[string]Value), Order: []string{}, config: config}
+}
@@ -0,0 +1,98 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+)
+
+var baselineDump = `{
+    "com.apple.dock" = {
+        autohide = 0;
+        orientation = bottom;
+        tilesize = 64;
+        "persistent-apps" = (Safari, Mail);
+    };
+    NSGlobalDomain = {
+        AppleInterfaceStyleSwitchesAutomatically = 1;
+    };
+}`
+
+// captureBaseline returns baselineDump the way `baseline capture` saves it.
+func captureBaseline(t *testing.T) Value {
+	t.Helper()
+	data, err := EncodeJSON(parseValue(baselineDump))
+	if err != nil {
+		t.Fatalf("EncodeJSON() error = %v", err)
+	}
+	baseline, err := DecodeJSON(data, Options{})
+	if err != nil {
+		t.Fatalf("DecodeJSON() error = %v", err)
+	}
+	return baseline
+}
+
+func TestStripBaseline(t *testing.T) {
+	config := Options{Baseline: captureBaseline(t)}
+
+	converted, err := ConvertDomain(strings.NewReader(`{
+    autohide = 1;
+    orientation = bottom;
+    tilesize = "64.0";
+    "persistent-apps" = (Safari, Mail, Notes);
+    "show-recents" = 0;
+}`), "com.apple.dock", config, nil)
+	if err != nil {
+		t.Fatalf("convertDomain() error = %v", err)
+	}
+
+	expected := `{
+  autohide = true;
+  "persistent-apps" = [
+    "Safari"
+    "Mail"
+    "Notes"
+  ];
+  "show-recents" = false;
+}`
+	if result := render(converted.Value, config.Format); result != expected {
+		t.Errorf("convertDomain() =\n%s\nwant\n%s", result, expected)
+	}
+}
+
+func TestStripBaseline_AllDomains(t *testing.T) {
+	config := Options{Baseline: captureBaseline(t)}
+
+	tests := []struct {
+		name     string
+		domain   string
+		input    string
+		expected string
+	}{
+		{
+			"Unchanged install",
+			"",
+			baselineDump,
+			"{}",
+		},
+		{
+			"Domain missing from the baseline",
+			"com.example.app",
+			`{ enabled = 1; }`,
+			"{\n  enabled = true;\n}",
+		},
+		{
+			"All domains",
+			"",
+			`{ "com.apple.dock" = { autohide = 0; tilesize = 48; }; NSGlobalDomain = { AppleInterfaceStyleSwitchesAutomatically = 1; }; }`,
+			"{\n  \"com.apple.dock\" = {\n    tilesize = 48;\n  };\n}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := stripBaseline(parseValue(tt.input), tt.domain, config)
+			if result := value.ToNix(0); result != tt.expected {
+				t.Errorf("stripBaseline() =\n%s\nwant\n%s", result, tt.expected)
+			}
+		})
+	}
+}
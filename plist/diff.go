@@ -0,0 +1,116 @@
+package plist
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// ChangeKind is the kind of difference found at a key path.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is a difference between two values at a key path.
+type Change struct {
+	Kind ChangeKind
+	Path []string
+	Old  Value // nil when added
+	New  Value // nil when removed
+}
+
+// Diff compares old and new and returns the changed key paths, in the
+// order of old followed by the keys only found in new. Dictionaries are
+// compared key by key, other values by the Nix they render to, so that
+// formatting differences such as 0.20 and 0.2 don't count as changes.
+// Arrays are compared as a whole.
+func Diff(old, new Value) []Change {
+	var changes []Change
+	diffValuesAt(old, new, nil, &changes)
+	return changes
+}
+
+func diffValuesAt(old, new Value, path []string, changes *[]Change) {
+	old, _ = UnwrapComment(old)
+	new, _ = UnwrapComment(new)
+
+	oldDict, oldIsDict := old.(DictValue)
+	newDict, newIsDict := new.(DictValue)
+	if !oldIsDict || !newIsDict {
+		if old.ToNix(0) != new.ToNix(0) {
+			*changes = append(*changes, Change{Kind: ChangeChanged, Path: path, Old: old, New: new})
+		}
+		return
+	}
+
+	newKeys := make(map[string]string)
+	for _, key := range DictKeys(newDict) {
+		if IsPresent(newDict.Values[key]) {
+			newKeys[UnquoteKey(key)] = key
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range DictKeys(oldDict) {
+		value := oldDict.Values[key]
+		if !IsPresent(value) {
+			continue
+		}
+		name := UnquoteKey(key)
+		seen[name] = true
+		childPath := append(slices.Clone(path), name)
+		if newKey, ok := newKeys[name]; ok {
+			diffValuesAt(value, newDict.Values[newKey], childPath, changes)
+		} else {
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Path: childPath, Old: value})
+		}
+	}
+
+	for _, key := range DictKeys(newDict) {
+		value := newDict.Values[key]
+		name := UnquoteKey(key)
+		if !IsPresent(value) || seen[name] {
+			continue
+		}
+		*changes = append(*changes, Change{Kind: ChangeAdded, Path: append(slices.Clone(path), name), New: value})
+	}
+}
+
+// IsPresent reports whether value would be written to the output.
+func IsPresent(value Value) bool {
+	value, _ = UnwrapComment(value)
+	_, isSkip := value.(SkipValue)
+	return value != nil && !isSkip
+}
+
+var nixLineBreak = regexp.MustCompile(`\n\s*`)
+
+// InlineNix renders value on a single line.
+func InlineNix(value Value) string {
+	value, _ = UnwrapComment(value)
+	return nixLineBreak.ReplaceAllString(value.ToNix(0), " ")
+}
+
+// FormatChange renders a change as a line of diff output.
+func FormatChange(domain string, c Change) string {
+	path := FormatDomainPath(domain, c.Path)
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s = %s", path, InlineNix(c.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s = %s", path, InlineNix(c.Old))
+	default:
+		return fmt.Sprintf("~ %s = %s -> %s", path, InlineNix(c.Old), InlineNix(c.New))
+	}
+}
+
+// Normalize renders value the way it would be written to a file and
+// parses the result back, so that filtered keys disappear and the value can
+// be compared with a parsed Nix file.
+func Normalize(value Value, config Options) (Value, error) {
+	return ParseNix(render(value, config.Format))
+}
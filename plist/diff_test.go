@@ -0,0 +1,54 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	old := parseValue(`{
+    autohide = 1;
+    orientation = left;
+    tilesize = 48;
+    "workspace-state" = {
+        lastSpace = 1;
+    };
+}`)
+	new := parseValue(`{
+    autohide = 0;
+    tilesize = "48.0";
+    "workspace-state" = {
+        lastSpace = 1;
+        showRecents = 0;
+    };
+    magnification = 1;
+}`)
+
+	var got []string
+	for _, c := range Diff(old, new) {
+		got = append(got, FormatChange("com.apple.dock", c))
+	}
+
+	expected := []string{
+		"~ com.apple.dock:autohide = true -> false",
+		"- com.apple.dock:orientation = \"left\"",
+		"+ com.apple.dock:workspace-state.showRecents = false",
+		"+ com.apple.dock:magnification = true",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("diffValues() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestDiffValues_Arrays(t *testing.T) {
+	old := parseValue(`{ apps = (Safari, Mail); }`)
+	new := parseValue(`{ apps = (Mail, Safari); }`)
+
+	changes := Diff(old, new)
+	if len(changes) != 1 {
+		t.Fatalf("Expected one change, got %d", len(changes))
+	}
+	if result := FormatChange("com.apple.dock", changes[0]); result != `~ com.apple.dock:apps = [ "Safari" "Mail" ] -> [ "Mail" "Safari" ]` {
+		t.Errorf("Unexpected change: %s", result)
+	}
+}
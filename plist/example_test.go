@@ -0,0 +1,84 @@
+package plist_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joshryandavis/defaults2nix/plist"
+)
+
+const dock = `{
+    autohide = 1;
+    mineffect = genie;
+    "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+    tilesize = 48;
+}`
+
+func ExampleParse() {
+	value, err := plist.Parse(strings.NewReader(dock), "com.apple.dock", plist.Options{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(value.ToNix(0))
+	// Output:
+	// {
+	//   autohide = true;
+	//   mineffect = "genie";
+	//   "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+	//   tilesize = 48;
+	// }
+}
+
+func ExampleRender() {
+	options := plist.NewOptions()
+	options.Format = plist.FormatHomeManager
+	options.Home = plist.NewHomeTemplate("/Users/josh", options.Format)
+
+	value, err := plist.Parse(strings.NewReader(`{ DownloadsPath = "/Users/josh/Downloads"; }`), "com.apple.Safari", options)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := plist.Render(os.Stdout, value, options.Format); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// { config, ... }:
+	// {
+	//   DownloadsPath = "${config.home.homeDirectory}/Downloads";
+	// }
+}
+
+func ExampleNewOptions() {
+	options := plist.NewOptions(plist.FilterState(), plist.FilterDates())
+	value, err := plist.Parse(strings.NewReader(dock), "com.apple.dock", options)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(value.ToNix(0))
+	// Output:
+	// {
+	//   autohide = true;
+	//   mineffect = "genie";
+	//   tilesize = 48;
+	// }
+}
+
+func ExampleParseFilter() {
+	var filters []plist.Filter
+	for _, name := range strings.Split("state,bogus", ",") {
+		filter, err := plist.ParseFilter(name)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	fmt.Println(plist.NewOptions(filters...).NoState)
+	// Output:
+	// Unknown filter option 'bogus'. Valid options are: dates, state, uuids, secrets, usage, recents, versions
+	// true
+}
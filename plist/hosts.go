@@ -0,0 +1,113 @@
+package plist
+
+// HostSplit is the result of splitting the settings of several hosts into
+// shared and host specific settings.
+type HostSplit struct {
+	Common Value   // Settings the hosts agree on
+	Hosts  []Value // Deviations from Common, in the order of the hosts
+}
+
+// SplitHosts compares the settings of every host key path by key path.
+// A value shared by at least quorum hosts goes into Common, and every host
+// with a different value keeps its own in Hosts. When no value reaches the
+// quorum, every host keeps its own value. Arrays are compared as a whole.
+//
+// Hosts without a key get the value from Common when it has one, as there
+// is no way to leave a key out for a single host.
+func SplitHosts(hosts []Value, quorum int) HostSplit {
+	var paths [][]string
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		for _, path := range LeafPaths(host, nil) {
+			if key := pathKey(path); !seen[key] {
+				seen[key] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	common := DictValue{Values: make(map[string]Value), Order: []string{}}
+	deviations := make([]DictValue, len(hosts))
+	for i := range deviations {
+		deviations[i] = DictValue{Values: make(map[string]Value), Order: []string{}}
+	}
+
+	for _, path := range paths {
+		values := make([]Value, len(hosts)) // nil where a host doesn't have the key
+		for i, host := range hosts {
+			if value, ok := ValueAt(host, path); ok && IsPresent(value) {
+				values[i] = value
+			}
+		}
+
+		// Pick the value most hosts agree on, the first one seen on ties
+		var shared Value
+		sharedCount := 0
+		for _, value := range values {
+			if value == nil {
+				continue
+			}
+			count := 0
+			for _, other := range values {
+				if other != nil && compareValues(value, other) {
+					count++
+				}
+			}
+			if count > sharedCount {
+				shared, sharedCount = value, count
+			}
+		}
+		if sharedCount >= quorum {
+			common = setValueAt(common, path, shared)
+		} else {
+			shared = nil
+		}
+
+		for i, value := range values {
+			if value != nil && (shared == nil || !compareValues(value, shared)) {
+				deviations[i] = setValueAt(deviations[i], path, value)
+			}
+		}
+	}
+
+	result := HostSplit{Common: common}
+	for _, d := range deviations {
+		result.Hosts = append(result.Hosts, d)
+	}
+	return result
+}
+
+// setValueAt returns dict with the value at path set, creating the
+// dictionaries on the way. An empty dictionary doesn't replace an existing
+// value.
+func setValueAt(dict DictValue, path []string, value Value) DictValue {
+	if len(path) == 0 {
+		return dict
+	}
+	key := nixKey(path[0])
+	for _, existing := range DictKeys(dict) {
+		if UnquoteKey(existing) == path[0] {
+			key = existing
+			break
+		}
+	}
+	existing, exists := dict.Values[key]
+	if !exists {
+		dict.Order = append(dict.Order, key)
+	}
+
+	if len(path) == 1 {
+		if empty, ok := value.(DictValue); exists && ok && len(empty.Values) == 0 {
+			return dict
+		}
+		dict.Values[key] = value
+		return dict
+	}
+
+	child, ok := existing.(DictValue)
+	if !ok {
+		child = DictValue{Values: make(map[string]Value), Order: []string{}}
+	}
+	dict.Values[key] = setValueAt(child, path[1:], value)
+	return dict
+}
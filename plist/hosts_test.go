@@ -0,0 +1,78 @@
+package plist
+
+import (
+	"testing"
+)
+
+func TestSplitHosts(t *testing.T) {
+	hosts := []Value{
+		parseValue(`{ "com.apple.dock" = { autohide = 1; tilesize = 48; orientation = left; }; NSGlobalDomain = { AppleLocale = "en_US"; }; }`),
+		parseValue(`{ "com.apple.dock" = { autohide = 1; tilesize = 64; }; NSGlobalDomain = { AppleLocale = "en_US"; }; }`),
+		parseValue(`{ "com.apple.dock" = { autohide = 1; tilesize = 48; }; NSGlobalDomain = { AppleLocale = "en_GB"; }; }`),
+	}
+
+	tests := []struct {
+		name   string
+		quorum int
+		common string
+		hosts  []string
+	}{
+		{
+			"All hosts",
+			3,
+			"{\n  \"com.apple.dock\" = {\n    autohide = true;\n  };\n}",
+			[]string{
+				"{\n  \"com.apple.dock\" = {\n    tilesize = 48;\n    orientation = \"left\";\n  };\n  NSGlobalDomain = {\n    AppleLocale = \"en_US\";\n  };\n}",
+				"{\n  \"com.apple.dock\" = {\n    tilesize = 64;\n  };\n  NSGlobalDomain = {\n    AppleLocale = \"en_US\";\n  };\n}",
+				"{\n  \"com.apple.dock\" = {\n    tilesize = 48;\n  };\n  NSGlobalDomain = {\n    AppleLocale = \"en_GB\";\n  };\n}",
+			},
+		},
+		{
+			"Quorum",
+			2,
+			"{\n  \"com.apple.dock\" = {\n    autohide = true;\n    tilesize = 48;\n  };\n  NSGlobalDomain = {\n    AppleLocale = \"en_US\";\n  };\n}",
+			[]string{
+				"{\n  \"com.apple.dock\" = {\n    orientation = \"left\";\n  };\n}",
+				"{\n  \"com.apple.dock\" = {\n    tilesize = 64;\n  };\n}",
+				"{\n  NSGlobalDomain = {\n    AppleLocale = \"en_GB\";\n  };\n}",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			split := SplitHosts(hosts, tt.quorum)
+			if result := split.Common.ToNix(0); result != tt.common {
+				t.Errorf("Common =\n%s\nwant\n%s", result, tt.common)
+			}
+			for i, expected := range tt.hosts {
+				if result := split.Hosts[i].ToNix(0); result != expected {
+					t.Errorf("Hosts[%d] =\n%s\nwant\n%s", i, result, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSetValueAt(t *testing.T) {
+	dict := DictValue{Values: make(map[string]Value), Order: []string{}}
+	dict = setValueAt(dict, []string{"com.apple.dock", "tile-data", "file-label"}, StringValue{Value: "Safari"})
+	dict = setValueAt(dict, []string{"com.apple.dock", "autohide"}, StringValue{Value: "1"})
+	dict = setValueAt(dict, []string{"com.apple.dock"}, DictValue{Values: make(map[string]Value)})
+	dict = setValueAt(dict, []string{"NSGlobalDomain", "Apple@Key"}, StringValue{Value: "0"})
+
+	expected := `{
+  "com.apple.dock" = {
+    "tile-data" = {
+      "file-label" = "Safari";
+    };
+    autohide = true;
+  };
+  NSGlobalDomain = {
+    "Apple@Key" = false;
+  };
+}`
+	if result := dict.ToNix(0); result != expected {
+		t.Errorf("setValueAt() =\n%s\nwant\n%s", result, expected)
+	}
+}
@@ -0,0 +1,162 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EncodeJSON encodes value as JSON. Attribute sets become objects that
+// keep their key order, and leaves keep the type they have in the Nix
+// output, so `1` becomes true rather than the string "1". Skipped values are
+// left out.
+func EncodeJSON(value Value) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, value Value) error {
+	value, _ = UnwrapComment(value)
+	switch v := value.(type) {
+	case DictValue:
+		buf.WriteByte('{')
+		first := true
+		for _, key := range DictKeys(v) {
+			child, ok := v.Values[key]
+			if !ok || !IsPresent(child) {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			name, err := json.Marshal(UnquoteKey(key))
+			if err != nil {
+				return err
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, child); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case ArrayValue:
+		buf.WriteByte('[')
+		first := true
+		for _, child := range v.Values {
+			if !IsPresent(child) {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			if err := writeJSON(buf, child); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case StringValue:
+		nix := v.ToNix(0)
+		if nix == "true" || nix == "false" || !strings.HasPrefix(nix, "\"") {
+			// Booleans and numbers are written the same way in both
+			buf.WriteString(nix)
+			return nil
+		}
+		data, err := json.Marshal(v.Value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	default:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// DecodeJSON decodes JSON written by EncodeJSON. Object keys keep
+// their order and are quoted when they are not valid Nix identifiers, the
+// way `defaults read` output is parsed, and strings and numbers are
+// filtered according to config like values in `defaults read` output.
+func DecodeJSON(data []byte, config Options) (Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := readJSON(dec, config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+func readJSON(dec *json.Decoder, config Options) (Value, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			result := ArrayValue{Values: []Value{}, config: config}
+			for dec.More() {
+				child, err := readJSON(dec, config)
+				if err != nil {
+					return nil, err
+				}
+				result.Values = append(result.Values, child)
+			}
+			_, err := dec.Token()
+			return result, err
+		}
+		result := DictValue{Values: make(map[string]Value), Order: []string{}, config: config}
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := nixKey(token.(string))
+			child, err := readJSON(dec, config)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := result.Values[key]; !exists {
+				result.Order = append(result.Order, key)
+			}
+			result.Values[key] = child
+		}
+		_, err := dec.Token()
+		return result, err
+	case bool:
+		if t {
+			return StringValue{Value: "1"}, nil
+		}
+		return StringValue{Value: "0"}, nil
+	case json.Number:
+		// Like numbers in Nix files, keep 0 and 1 from turning into booleans
+		if t == "0" || t == "1" {
+			return StringValue{Value: string(t) + ".0"}, nil
+		}
+		return parseScalarWithConfig(string(t), config), nil
+	case string:
+		return parseScalarWithConfig(t, config), nil
+	default:
+		return SkipValue{}, nil
+	}
+}
+
+// nixKey returns name as a dictionary key, quoted when it is not a valid
+// Nix identifier.
+func nixKey(name string) string {
+	if isNixIdentifier(name) {
+		return name
+	}
+	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(name, "\"", "\\\""))
+}
@@ -0,0 +1,68 @@
+package plist
+
+import "testing"
+
+func TestMarshalValue(t *testing.T) {
+	value := parseValue(`{
+    autohide = 1;
+    tilesize = 48;
+    "autohide-delay" = "0.2";
+    orientation = left;
+    "persistent-apps" = (
+        {
+            "tile-data" = { "file-label" = Safari; };
+        },
+        "/Applications/Mail.app"
+    );
+    "NSWindow Frame Main" = "0 0 800 600";
+    empty = {};
+}`)
+
+	data, err := EncodeJSON(value)
+	if err != nil {
+		t.Fatalf("marshalValue() error = %v", err)
+	}
+	expected := `{"autohide":true,"tilesize":48,"autohide-delay":0.2,"orientation":"left",` +
+		`"persistent-apps":[{"tile-data":{"file-label":"Safari"}},"/Applications/Mail.app"],` +
+		`"NSWindow Frame Main":"0 0 800 600","empty":{}}`
+	if string(data) != expected {
+		t.Errorf("marshalValue() =\n%s\nwant\n%s", data, expected)
+	}
+}
+
+func TestUnmarshalValue_RoundTrip(t *testing.T) {
+	input := `{
+    autohide = 1;
+    magnification = 0;
+    tilesize = 48;
+    "autohide-delay" = "0.2";
+    "large-size" = "1.0";
+    orientation = left;
+    "NSWindow Frame Main" = "0 0 800 600";
+    "persistent-apps" = ("/Applications/Mail.app", Safari);
+    "com.apple.keyboard" = { fnState = 1; };
+}`
+	value := parseValue(input)
+	data, err := EncodeJSON(value)
+	if err != nil {
+		t.Fatalf("marshalValue() error = %v", err)
+	}
+	decoded, err := DecodeJSON(data, Options{})
+	if err != nil {
+		t.Fatalf("unmarshalValue() error = %v", err)
+	}
+	if result, expected := decoded.ToNix(0), value.ToNix(0); result != expected {
+		t.Errorf("Round trip changed the value:\n%s\nwant\n%s", result, expected)
+	}
+	if len(Diff(value, decoded)) != 0 {
+		t.Errorf("Expected no differences after a round trip, got %v", Diff(value, decoded))
+	}
+}
+
+func TestUnmarshalValue_Invalid(t *testing.T) {
+	for _, input := range []string{`{"a": }`, `{"a": 1} {}`, `[1, 2`} {
+		if _, err := DecodeJSON([]byte(input), Options{}); err == nil {
+			t.Errorf("unmarshalValue(%q) expected an error", input)
+		}
+	}
+}
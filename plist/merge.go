@@ -0,0 +1,294 @@
+package plist
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Comment lines at the end of a merged file that record which keys were
+// deleted by hand, and every key known at the last merge. A key that is
+// known but missing from the file was deleted since, and is added to the
+// ignore list instead of being merged back in.
+const (
+	mergeIgnorePrefix = "# defaults2nix-ignore: "
+	mergeKnownPrefix  = "# defaults2nix-known: "
+)
+
+var mergeMetadataLine = regexp.MustCompile(`(?m)^# defaults2nix-(ignore|known): .*\n?`)
+
+// MergeResult is the outcome of merging defaults into an existing file.
+type MergeResult struct {
+	Output  string
+	Changed []string // Key paths whose value was updated
+	Added   []string // Key paths appended to the file
+	Ignored []string // Key paths deleted by hand, now on the ignore list
+	Stale   []string // Key paths in the file that are no longer in the defaults
+}
+
+// MergeMetadata is the merge state recorded in a file.
+type MergeMetadata struct {
+	Found  bool            // Whether the file has been merged into before
+	Ignore [][]string      // Key paths that stay out of the file
+	Known  map[string]bool // Key paths known at the last merge, by pathKey
+}
+
+// ReadMergeMetadata reads the ignore list and the known keys recorded at the
+// end of a merged file. Files that were never merged into have neither, and
+// Found is false.
+func ReadMergeMetadata(input string) (MergeMetadata, error) {
+	meta := MergeMetadata{Known: make(map[string]bool)}
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if path, ok := strings.CutPrefix(line, mergeIgnorePrefix); ok {
+			meta.Ignore = append(meta.Ignore, parseKeyPath(path))
+		}
+		if known, ok := strings.CutPrefix(line, mergeKnownPrefix); ok {
+			var paths [][]string
+			if err := json.Unmarshal([]byte(known), &paths); err != nil {
+				return meta, fmt.Errorf("invalid %s line: %v", strings.TrimSpace(mergeKnownPrefix), err)
+			}
+			for _, path := range paths {
+				meta.Known[pathKey(path)] = true
+			}
+			meta.Found = true
+		}
+	}
+	return meta, nil
+}
+
+// Ignores reports whether path or one of its parents matches an entry of the
+// ignore list. Entries may contain '*' wildcards.
+func (m MergeMetadata) Ignores(path []string) bool {
+	for _, pattern := range m.Ignore {
+		if len(pattern) == 0 || len(pattern) > len(path) {
+			continue
+		}
+		matched := true
+		for i, segment := range pattern {
+			if !matchWildcard(segment, path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// LeafPaths returns the key paths of every value below value that is not a
+// dictionary. Arrays are leaves, as they are compared as a whole.
+func LeafPaths(value Value, path []string) [][]string {
+	value, _ = UnwrapComment(value)
+	dict, ok := value.(DictValue)
+	if !ok || len(dict.Values) == 0 {
+		if !IsPresent(value) {
+			return nil
+		}
+		return [][]string{path}
+	}
+	var paths [][]string
+	for _, key := range DictKeys(dict) {
+		paths = append(paths, LeafPaths(dict.Values[key], append(slices.Clone(path), UnquoteKey(key)))...)
+	}
+	return paths
+}
+
+// ValueAt returns the value at path below value.
+func ValueAt(value Value, path []string) (Value, bool) {
+	for _, segment := range path {
+		value, _ = UnwrapComment(value)
+		dict, ok := value.(DictValue)
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for _, key := range DictKeys(dict) {
+			if UnquoteKey(key) == segment {
+				value, found = dict.Values[key], true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// MergeNix merges current, the normalized defaults of domain, into existing,
+// the source of a previously generated Nix file that may have been edited
+// since. Changed values are replaced in place, keeping any lib.mkDefault
+// style wrapper and trailing comment, and new keys are appended to their
+// attribute set. Keys deleted from the file are recorded on its ignore list
+// and stay deleted. Everything else in the file is left as it was.
+//
+// Files written by -out or -split record their keys with MarkKnown. A file
+// without merge state, such as one written by hand, is taken to know exactly
+// the keys it declares, so the first merge appends every key missing from
+// it.
+func MergeNix(existing string, current Value, domain string) (MergeResult, error) {
+	var result MergeResult
+
+	p := &nixParser{input: existing, attrs: make(map[string]nixAttr), sets: make(map[string]nixAttrset)}
+	declared, err := p.parseFile()
+	if err != nil {
+		return result, err
+	}
+	if _, ok := p.sets[pathKey(nil)]; !ok {
+		return result, fmt.Errorf("expected an attribute set")
+	}
+	meta, err := ReadMergeMetadata(existing)
+	if err != nil {
+		return result, err
+	}
+	if !meta.Found {
+		for _, path := range LeafPaths(declared, nil) {
+			meta.Known[pathKey(path)] = true
+		}
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	inserts := make(map[string][][]string) // Attribute set key path -> new key paths below it
+	var insertSets [][]string
+
+	for _, c := range Diff(declared, current) {
+		switch c.Kind {
+		case ChangeChanged:
+			attr, ok := p.attrs[pathKey(c.Path)]
+			if !ok {
+				continue
+			}
+			value, _ := UnwrapComment(c.New)
+			text := indentLines(value.ToNix(0), lineIndent(existing, attr.Start))
+			edits = append(edits, edit{attr.ValueStart, attr.ValueEnd, text})
+			result.Changed = append(result.Changed, FormatDomainPath(domain, c.Path))
+		case ChangeRemoved:
+			result.Stale = append(result.Stale, FormatDomainPath(domain, c.Path))
+		case ChangeAdded:
+			for _, path := range LeafPaths(c.New, c.Path) {
+				switch {
+				case meta.Ignores(path):
+				case meta.Known[pathKey(path)]:
+					meta.Ignore = append(meta.Ignore, path)
+					result.Ignored = append(result.Ignored, FormatDomainPath(domain, path))
+				default:
+					// Insert below the deepest attribute set already in the file
+					parent := path[:len(path)-1]
+					for len(parent) > 0 {
+						if _, ok := p.sets[pathKey(parent)]; ok {
+							break
+						}
+						parent = parent[:len(parent)-1]
+					}
+					if _, ok := inserts[pathKey(parent)]; !ok {
+						insertSets = append(insertSets, parent)
+					}
+					inserts[pathKey(parent)] = append(inserts[pathKey(parent)], path[len(parent):])
+					result.Added = append(result.Added, FormatDomainPath(domain, path))
+				}
+			}
+		}
+	}
+
+	for _, parent := range insertSets {
+		set := p.sets[pathKey(parent)]
+		value, _ := ValueAt(current, parent)
+		selected, ok := SelectPaths(value, inserts[pathKey(parent)])
+		if !ok {
+			continue
+		}
+		// Render the new keys as a dictionary and keep its entry lines
+		lines := strings.Split(selected.ToNix(0), "\n")
+		lines = lines[1 : len(lines)-1]
+
+		// Follow the indentation of the existing entries when they are on
+		// their own lines
+		entryIndent := lineIndent(existing, set.Open) + "  "
+		if set.Entry >= 0 && startsLine(existing, set.Entry) {
+			entryIndent = lineIndent(existing, set.Entry)
+		}
+		var sb strings.Builder
+		for _, line := range lines {
+			sb.WriteString(entryIndent + strings.TrimPrefix(line, "  ") + "\n")
+		}
+		if startsLine(existing, set.Close) {
+			closeStart := strings.LastIndexByte(existing[:set.Close], '\n') + 1
+			edits = append(edits, edit{closeStart, closeStart, sb.String()})
+		} else {
+			// Move a closing brace that shares a line with other code to a
+			// line of its own
+			end := len(strings.TrimRight(existing[:set.Close], " \t"))
+			edits = append(edits, edit{end, set.Close, "\n" + sb.String() + lineIndent(existing, set.Open)})
+		}
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	output := existing
+	for _, e := range edits {
+		output = output[:e.start] + e.text + output[e.end:]
+	}
+
+	// Rewrite the merge state at the end of the file
+	result.Output, err = writeMergeMetadata(output, meta.Ignore, LeafPaths(current, nil))
+	return result, err
+}
+
+// MarkKnown records every key declared by source, the contents of a
+// generated Nix file, as known at the end of it. A later MergeNix then
+// keeps keys deleted from the file by hand out of it, and only appends keys
+// that are new to the defaults.
+func MarkKnown(source string) (string, error) {
+	declared, err := ParseNix(source)
+	if err != nil {
+		return source, err
+	}
+	return writeMergeMetadata(source, nil, LeafPaths(declared, nil))
+}
+
+// writeMergeMetadata replaces the merge state at the end of source with
+// the ignore list and the known keys.
+func writeMergeMetadata(source string, ignore, known [][]string) (string, error) {
+	if known == nil {
+		known = [][]string{}
+	}
+	knownJSON, err := json.Marshal(known)
+	if err != nil {
+		return source, err
+	}
+	output := strings.TrimRight(mergeMetadataLine.ReplaceAllString(source, ""), "\n") + "\n\n"
+	for _, path := range ignore {
+		output += mergeIgnorePrefix + FormatKeyPath(path) + "\n"
+	}
+	return output + mergeKnownPrefix + string(knownJSON) + "\n", nil
+}
+
+// lineIndent returns the leading whitespace of the line containing pos.
+func lineIndent(s string, pos int) string {
+	start := strings.LastIndexByte(s[:pos], '\n') + 1
+	end := start
+	for end < len(s) && (s[end] == ' ' || s[end] == '\t') {
+		end++
+	}
+	return s[start:end]
+}
+
+// startsLine reports whether only whitespace precedes pos on its line.
+func startsLine(s string, pos int) bool {
+	start := strings.LastIndexByte(s[:pos], '\n') + 1
+	return strings.TrimSpace(s[start:pos]) == ""
+}
+
+// indentLines prefixes every line of s but the first with indent.
+func indentLines(s, indent string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+indent)
+}
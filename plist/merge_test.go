@@ -0,0 +1,174 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustNormalize(t *testing.T, input string, config Options) Value {
+	t.Helper()
+	value, err := Normalize(parseValueWithConfig(input, config), config)
+	if err != nil {
+		t.Fatalf("normalizeValue() error = %v", err)
+	}
+	return value
+}
+
+func TestMergeNix(t *testing.T) {
+	existing := `{ lib, ... }:
+# Dock settings, tuned by hand
+{
+  autohide = lib.mkDefault false; # keep the dock visible on the laptop
+  tilesize    = 48;
+  "workspace-state" = {
+    showRecents = false;
+  };
+  legacy = "kept";
+}
+
+# defaults2nix-ignore: orientation
+# defaults2nix-known: [["autohide"],["orientation"],["tilesize"],["magnification"],["workspace-state","showRecents"]]
+`
+	current := mustNormalize(t, `{
+    autohide = 1;
+    magnification = 1;
+    orientation = left;
+    tilesize = 48;
+    "workspace-state" = {
+        showRecents = 0;
+        lastSpace = 2;
+    };
+    "persistent-apps" = (Safari);
+}`, Options{})
+
+	result, err := MergeNix(existing, current, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+
+	expected := `{ lib, ... }:
+# Dock settings, tuned by hand
+{
+  autohide = lib.mkDefault true; # keep the dock visible on the laptop
+  tilesize    = 48;
+  "workspace-state" = {
+    showRecents = false;
+    lastSpace = 2;
+  };
+  legacy = "kept";
+  "persistent-apps" = [
+    "Safari"
+  ];
+}
+
+# defaults2nix-ignore: orientation
+# defaults2nix-ignore: magnification
+# defaults2nix-known: [["autohide"],["magnification"],["orientation"],["tilesize"],["workspace-state","showRecents"],["workspace-state","lastSpace"],["persistent-apps"]]
+`
+	if result.Output != expected {
+		t.Errorf("mergeNix() =\n%s\nwant\n%s", result.Output, expected)
+	}
+
+	checks := []struct {
+		name     string
+		got      []string
+		expected []string
+	}{
+		{"Changed", result.Changed, []string{"com.apple.dock:autohide"}},
+		{"Added", result.Added, []string{"com.apple.dock:workspace-state.lastSpace", "com.apple.dock:persistent-apps"}},
+		{"Ignored", result.Ignored, []string{"com.apple.dock:magnification"}},
+		{"Stale", result.Stale, []string{"com.apple.dock:legacy"}},
+	}
+	for _, c := range checks {
+		if strings.Join(c.got, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.expected)
+		}
+	}
+}
+
+func TestMergeNix_FirstMergeAppendsMissingKeys(t *testing.T) {
+	// A file without merge state, such as one written by hand
+	existing := "{\n  autohide = true;\n}\n"
+	current := mustNormalize(t, `{ autohide = 0; tilesize = 48; }`, Options{})
+
+	result, err := MergeNix(existing, current, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+
+	expected := "{\n  autohide = false;\n  tilesize = 48;\n}\n\n# defaults2nix-known: [[\"autohide\"],[\"tilesize\"]]\n"
+	if result.Output != expected {
+		t.Errorf("mergeNix() =\n%s\nwant\n%s", result.Output, expected)
+	}
+	if len(result.Added) != 1 || len(result.Ignored) != 0 {
+		t.Errorf("Expected tilesize to be added, got added %v, ignored %v", result.Added, result.Ignored)
+	}
+
+	// Merging again changes nothing
+	again, err := MergeNix(result.Output, current, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+	if again.Output != result.Output || len(again.Changed)+len(again.Added)+len(again.Ignored) > 0 {
+		t.Errorf("Expected second merge to be a no-op, got:\n%s", again.Output)
+	}
+}
+
+func TestMergeNix_KnownKeysStayDeleted(t *testing.T) {
+	// Keys deleted once the file has merge state stay deleted
+	existing := "{\n  autohide = true;\n}\n\n# defaults2nix-known: [[\"autohide\"],[\"tilesize\"]]\n"
+	current := mustNormalize(t, `{ autohide = 0; tilesize = 48; }`, Options{})
+
+	result, err := MergeNix(existing, current, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+
+	expected := "{\n  autohide = false;\n}\n\n# defaults2nix-ignore: tilesize\n# defaults2nix-known: [[\"autohide\"],[\"tilesize\"]]\n"
+	if result.Output != expected {
+		t.Errorf("mergeNix() =\n%s\nwant\n%s", result.Output, expected)
+	}
+
+	// Merging again changes nothing
+	again, err := MergeNix(result.Output, current, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+	if again.Output != result.Output || len(again.Changed)+len(again.Added)+len(again.Ignored) > 0 {
+		t.Errorf("Expected second merge to be a no-op, got:\n%s", again.Output)
+	}
+}
+
+func TestMergeNix_SingleLineAttrsets(t *testing.T) {
+	existing := "{ a = 1; nested = {}; }\n# defaults2nix-known: [[\"a\"]]\n"
+	current := mustNormalize(t, `{ a = 2; b = 3; nested = { c = 4; }; }`, Options{})
+
+	result, err := MergeNix(existing, current, "com.example")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+
+	expected := "{ a = 2; nested = {\n  c = 4;\n};\n  b = 3;\n}\n\n# defaults2nix-known: [[\"a\"],[\"b\"],[\"nested\",\"c\"]]\n"
+	if result.Output != expected {
+		t.Errorf("mergeNix() =\n%q\nwant\n%q", result.Output, expected)
+	}
+	if _, err := ParseNix(result.Output); err != nil {
+		t.Errorf("Merged output does not parse: %v", err)
+	}
+}
+
+func TestMergeNix_IgnoreWildcards(t *testing.T) {
+	existing := "{\n}\n# defaults2nix-ignore: NSWindow Frame*\n# defaults2nix-known: []\n"
+	current := mustNormalize(t, `{ "NSWindow Frame Main" = "0 0 800 600"; tilesize = 48; }`, Options{})
+
+	result, err := MergeNix(existing, current, "com.example")
+	if err != nil {
+		t.Fatalf("mergeNix() error = %v", err)
+	}
+	if strings.Contains(result.Output, "\"NSWindow Frame Main\" =") {
+		t.Errorf("Expected ignored key to stay out, got:\n%s", result.Output)
+	}
+	if !strings.Contains(result.Output, "  tilesize = 48;\n}") {
+		t.Errorf("Expected new key to be appended, got:\n%s", result.Output)
+	}
+}
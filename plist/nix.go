@@ -0,0 +1,519 @@
+package plist
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// functionHeader matches the function header Render writes before the
+// attribute set when home directory templating is used, e.g. "{ home }:".
+var functionHeader = regexp.MustCompile(`^(\{[^{}=;"]*\}|[A-Za-z_][A-Za-z0-9_'-]*)\s*:`)
+
+// HasFunctionHeader reports whether the Nix source src starts with a
+// function header, such as the one Render writes for home directory
+// templating.
+func HasFunctionHeader(src string) bool {
+	return functionHeader.MatchString(strings.TrimSpace(src))
+}
+
+// ParseNix reads back a Nix file written by this tool into the Value model.
+// It understands the subset of Nix produced by the ToNix methods: attribute
+// sets, lists, double-quoted and indented strings, numbers, booleans, null,
+// quoted attribute names and comments, optionally preceded by a function
+// header. Comments at the end of an attribute or list element line are kept
+// as CommentValue, and null becomes a SkipValue, which is never written.
+// Values wrapped in lib.mkDefault or lib.mkForce are read as the value.
+func ParseNix(input string) (Value, error) {
+	p := &nixParser{input: input}
+	return p.parseFile()
+}
+
+func (p *nixParser) parseFile() (Value, error) {
+	p.skipSpace()
+	if m := functionHeader.FindStringIndex(p.input[p.pos:]); m != nil {
+		p.pos += m[1]
+		p.skipSpace()
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q after value", p.input[p.pos])
+	}
+	return value, nil
+}
+
+type nixParser struct {
+	input string
+	pos   int
+
+	// When attrs is set, the parser records where each attribute and
+	// attribute set is in the input, by key path, outside of lists
+	attrs map[string]nixAttr
+	sets  map[string]nixAttrset
+	path  []string
+}
+
+// nixAttr is the location of an attribute in the source of a Nix file.
+type nixAttr struct {
+	Start      int // Start of the attribute name
+	ValueStart int // Start of the value, inside any lib.mkDefault wrapper
+	ValueEnd   int // End of the value
+}
+
+// nixAttrset is the location of an attribute set in the source of a Nix file.
+type nixAttrset struct {
+	Open  int // Position of the opening brace
+	Close int // Position of the closing brace
+	Entry int // Start of the first attribute, -1 when empty
+}
+
+// nixWrappers are the functions whose argument is read in place of the
+// application, as users wrap generated values in them.
+var nixWrappers = []string{"lib.mkDefault", "lib.mkForce", "mkDefault", "mkForce"}
+
+// pathKey joins a key path into a map key.
+func pathKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+func (p *nixParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.input[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *nixParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// skipSpace skips whitespace and comments.
+func (p *nixParser) skipSpace() {
+	for p.pos < len(p.input) {
+		switch c := p.input[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.input) && p.input[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.input[p.pos:], "/*"):
+			end := strings.Index(p.input[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.input)
+				return
+			}
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+// trailingComment consumes a "# comment" following on the same line.
+func (p *nixParser) trailingComment() string {
+	i := p.pos
+	for i < len(p.input) && (p.input[i] == ' ' || p.input[i] == '\t') {
+		i++
+	}
+	if i >= len(p.input) || p.input[i] != '#' {
+		return ""
+	}
+	end := strings.IndexByte(p.input[i:], '\n')
+	if end < 0 {
+		end = len(p.input) - i
+	}
+	p.pos = i + end
+	return strings.TrimSpace(p.input[i+1 : i+end])
+}
+
+func (p *nixParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		if p.pos >= len(p.input) {
+			return p.errorf("expected %q, found end of input", c)
+		}
+		return p.errorf("expected %q, found %q", c, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+// skipWrapper consumes a wrapper function such as lib.mkDefault.
+func (p *nixParser) skipWrapper() {
+	start := p.pos
+	if !isIdentStart(p.peek()) {
+		return
+	}
+	ident := p.parseIdent()
+	for p.peek() == '.' {
+		p.pos++
+		ident += "." + p.parseIdent()
+	}
+	if !slices.Contains(nixWrappers, ident) {
+		p.pos = start
+		return
+	}
+	p.skipSpace()
+}
+
+func (p *nixParser) parseValue() (Value, error) {
+	p.skipSpace()
+	p.skipWrapper()
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseAttrs()
+	case c == '[':
+		return p.parseList()
+	case c == '"':
+		return p.parseString()
+	case strings.HasPrefix(p.input[p.pos:], "''"):
+		return p.parseIndentedString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isIdentStart(c):
+		switch ident := p.parseIdent(); ident {
+		case "true":
+			return StringValue{Value: "1"}, nil
+		case "false":
+			return StringValue{Value: "0"}, nil
+		case "null":
+			return SkipValue{}, nil
+		default:
+			return nil, p.errorf("unsupported expression %q", ident)
+		}
+	case c == 0:
+		return nil, p.errorf("unexpected end of input")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *nixParser) parseAttrs() (Value, error) {
+	set := nixAttrset{Open: p.pos, Entry: -1}
+	path := p.path
+	p.pos++ // {
+	dict := DictValue{Values: make(map[string]Value), Order: []string{}}
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			set.Close = p.pos
+			if p.attrs != nil {
+				p.sets[pathKey(path)] = set
+			}
+			p.pos++
+			return dict, nil
+		}
+
+		attr := nixAttr{Start: p.pos}
+		if set.Entry < 0 {
+			set.Entry = p.pos
+		}
+		key, err := p.parseAttrName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('='); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		p.skipWrapper()
+		attr.ValueStart = p.pos
+		p.path = append(slices.Clone(path), UnquoteKey(key))
+		value, err := p.parseValue()
+		p.path = path
+		if err != nil {
+			return nil, err
+		}
+		attr.ValueEnd = p.pos
+		if err := p.expect(';'); err != nil {
+			return nil, err
+		}
+		if p.attrs != nil {
+			p.attrs[pathKey(append(slices.Clone(path), UnquoteKey(key)))] = attr
+		}
+		if comment := p.trailingComment(); comment != "" {
+			value = CommentValue{Value: value, Comment: comment}
+		}
+
+		if _, exists := dict.Values[key]; exists {
+			return nil, p.errorf("attribute %s already defined", key)
+		}
+		dict.Values[key] = value
+		dict.Order = append(dict.Order, key)
+	}
+}
+
+// parseAttrName returns an attribute name. Quoted names are returned with
+// their quotes and escapes, like the keys parsed from `defaults read`.
+func (p *nixParser) parseAttrName() (string, error) {
+	c := p.peek()
+	if c == '"' {
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.input) {
+			switch p.input[p.pos] {
+			case '\\':
+				p.pos += 2
+				continue
+			case '"':
+				p.pos++
+				return p.input[start:p.pos], nil
+			}
+			p.pos++
+		}
+		return "", p.errorf("unterminated attribute name")
+	}
+	// ToNix only quotes names with spaces, dots and dashes, so unquoted names
+	// run up to the next delimiter
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(" \t\r\n=;{}[]\"#", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		if c == 0 {
+			return "", p.errorf("expected attribute name, found end of input")
+		}
+		return "", p.errorf("expected attribute name, found %q", c)
+	}
+	return p.input[start:p.pos], nil
+}
+
+func (p *nixParser) parseList() (Value, error) {
+	// Lists are handled as a whole, so nothing inside them is recorded
+	attrs, sets := p.attrs, p.sets
+	p.attrs, p.sets = nil, nil
+	defer func() { p.attrs, p.sets = attrs, sets }()
+
+	p.pos++ // [
+	array := ArrayValue{Values: []Value{}}
+	for {
+		p.skipSpace()
+		if p.peek() == ']' {
+			p.pos++
+			return array, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if comment := p.trailingComment(); comment != "" {
+			value = CommentValue{Value: value, Comment: comment}
+		}
+		array.Values = append(array.Values, value)
+	}
+}
+
+// parseString reads a double-quoted string, undoing escapeNixString.
+func (p *nixParser) parseString() (Value, error) {
+	start := p.pos
+	p.pos++ // "
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			return p.decodeString(p.input[start+1:p.pos-1], false)
+		}
+		p.pos++
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+// parseIndentedString reads an indented string between two single quotes.
+// As in Nix, the indentation shared by all non-blank lines and a blank first
+// line are removed.
+func (p *nixParser) parseIndentedString() (Value, error) {
+	start := p.pos
+	p.pos += 2 // ''
+	for p.pos < len(p.input) {
+		if !strings.HasPrefix(p.input[p.pos:], "''") {
+			p.pos++
+			continue
+		}
+		// ''' ''$ and ''\x are escapes, any other '' ends the string
+		if rest := p.input[p.pos+2:]; rest != "" && (rest[0] == '\'' || rest[0] == '$' || rest[0] == '\\') {
+			p.pos += 3
+			if rest[0] == '\\' {
+				p.pos++
+			}
+			continue
+		}
+		raw := stripIndentation(p.input[start+2 : p.pos])
+		p.pos += 2
+		return p.decodeString(raw, true)
+	}
+	return nil, p.errorf("unterminated indented string")
+}
+
+// stripIndentation removes the indentation shared by all non-blank lines of
+// an indented string, and its first line when that is blank.
+func stripIndentation(raw string) string {
+	lines := strings.Split(raw, "\n")
+	indent := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if strings.TrimLeft(line, " ") == "" {
+			lines[i] = ""
+		} else if indent > 0 {
+			lines[i] = line[indent:]
+		}
+	}
+	if len(lines) > 1 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// decodeString resolves the escapes of a string literal. A ${expr}
+// interpolation, as written by home directory templating, is kept as a
+// literal "${expr}" that StringValue.ToNix writes back unchanged.
+func (p *nixParser) decodeString(raw string, indented bool) (Value, error) {
+	var sb strings.Builder
+	var expr string
+	for i := 0; i < len(raw); {
+		rest := raw[i:]
+		switch {
+		case !indented && rest[0] == '\\' && len(rest) > 1:
+			sb.WriteString(unescapeNixChar(rest[1]))
+			i += 2
+		case indented && strings.HasPrefix(rest, "''\\") && len(rest) > 3:
+			sb.WriteString(unescapeNixChar(rest[3]))
+			i += 4
+		case indented && strings.HasPrefix(rest, "'''"):
+			sb.WriteString("''")
+			i += 3
+		case indented && strings.HasPrefix(rest, "''$"):
+			sb.WriteString("$")
+			i += 3
+		case !indented && strings.HasPrefix(rest, "$''{"):
+			// Older versions escaped interpolations this way
+			sb.WriteString("${")
+			i += 4
+		case strings.HasPrefix(rest, "${"):
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, p.errorf("unterminated interpolation")
+			}
+			e := strings.TrimSpace(rest[2:end])
+			if expr != "" && e != expr {
+				return nil, p.errorf("unsupported interpolation of both %s and %s", expr, e)
+			}
+			expr = e
+			sb.WriteString("${" + e + "}")
+			i += end + 1
+		default:
+			sb.WriteByte(rest[0])
+			i++
+		}
+	}
+
+	if expr != "" {
+		return StringValue{Value: sb.String(), HomeDir: "${" + expr + "}", HomeExpr: expr}, nil
+	}
+	return StringValue{Value: sb.String()}, nil
+}
+
+func unescapeNixChar(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	default:
+		return string(c)
+	}
+}
+
+// parseNumber reads an integer or float. Integers 0 and 1 are kept as floats
+// so that they are not written back as booleans.
+func (p *nixParser) parseNumber() (Value, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	digits := p.pos
+	for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+		p.pos++
+	}
+	if p.pos == digits {
+		return nil, p.errorf("expected number after '-'")
+	}
+	isFloat := false
+	if p.peek() == '.' {
+		isFloat = true
+		p.pos++
+		for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+			p.pos++
+		}
+	}
+	if c := p.peek(); c == 'e' || c == 'E' {
+		isFloat = true
+		p.pos++
+		if c := p.peek(); c == '+' || c == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+			p.pos++
+		}
+	}
+
+	text := p.input[start:p.pos]
+	if !isFloat && (text == "0" || text == "1") {
+		text += ".0"
+	}
+	return StringValue{Value: text}, nil
+}
+
+func (p *nixParser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if !isIdentStart(c) && !isDigit(c) && c != '-' && c != '\'' {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// NixAttrPath joins path into a Nix attribute path, quoting the names that
+// need it.
+func NixAttrPath(path []string) string {
+	names := make([]string, len(path))
+	for i, name := range path {
+		if isNixIdentifier(name) {
+			names[i] = name
+		} else {
+			names[i] = fmt.Sprintf("\"%s\"", escapeNixString(name))
+		}
+	}
+	return strings.Join(names, ".")
+}
@@ -0,0 +1,245 @@
+package plist
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestParseNix(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Empty attrset", "{}", "{}"},
+		{"Booleans", "{ a = true; b = false; }", "{\n  a = true;\n  b = false;\n}"},
+		{"Numbers", "{ a = 48; b = -5; c = 0.2; d = 1; }", "{\n  a = 48;\n  b = -5;\n  c = 0.2;\n  d = 1;\n}"},
+		{"Strings", `{ a = "Dark"; b = "say \"hi\""; c = "C:\\dir"; }`, "{\n  a = \"Dark\";\n  b = \"say \\\"hi\\\"\";\n  c = \"C:\\\\dir\";\n}"},
+		{"Quoted names", `{ "autohide-delay" = 0.5; "com.apple.dock" = {}; }`, "{\n  \"autohide-delay\" = 0.5;\n  \"com.apple.dock\" = {};\n}"},
+		{"Lists", `{ apps = [ "Safari" "Mail" ]; empty = []; }`, "{\n  apps = [\n    \"Safari\"\n    \"Mail\"\n  ];\n  empty = [];\n}"},
+		{"Comments", "# generated\n{\n  /* block */\n  a = 1; # volatile\n}", "{\n  a = 1; # volatile\n}"},
+		{"Function header", "{ home }:\n{ a = \"${home}/Downloads\"; }", "{\n  a = \"${home}/Downloads\";\n}"},
+		{"Wrappers", "{ lib, ... }:\n{ a = lib.mkDefault true; b = mkForce [ 1 ]; }", "{\n  a = true;\n  b = [\n    1\n  ];\n}"},
+		{"Escaped interpolation", `{ a = "\${HOME}/bin"; }`, "{\n  a = \"\\${HOME}/bin\";\n}"},
+		{"Escaped interpolation by older versions", `{ a = "$''{HOME}/bin"; }`, "{\n  a = \"\\${HOME}/bin\";\n}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := ParseNix(tt.input)
+			if err != nil {
+				t.Fatalf("parseNix() error = %v", err)
+			}
+			if result := value.ToNix(0); result != tt.expected {
+				t.Errorf("parseNix(%q) =\n%s\nwant\n%s", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseNix_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"Missing semicolon", "{ a = 1 }", "line 1: expected ';'"},
+		{"Unterminated string", "{\n  a = \"x;\n}", "line 3: unterminated string"},
+		{"Duplicate attribute", "{ a = 1; a = 2; }", "attribute a already defined"},
+		{"Trailing input", "{} {}", "unexpected '{' after value"},
+		{"Unsupported expression", "{ a = lib.mkOverride 10 1; }", "unsupported expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseNix(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseNix(%q) error = %v, want %q", tt.input, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseNix_RoundTrip(t *testing.T) {
+	input := `{
+    autohide = 1;
+    "autohide-delay" = "0.2";
+    orientation = left;
+    "persistent-apps" = (
+        {
+            "tile-data" = {
+                "file-label" = Safari;
+                "file-data" = {
+                    "_CFURLString" = "file:///Applications/Safari.app/";
+                };
+            };
+        }
+    );
+    "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+    "magnification-factor" = "1.0";
+    "show-recents" = 0;
+}`
+
+	value := parseValue(input)
+	rendered := value.ToNix(0)
+	parsed, err := ParseNix(rendered)
+	if err != nil {
+		t.Fatalf("parseNix() error = %v\n%s", err, rendered)
+	}
+	if result := parsed.ToNix(0); result != rendered {
+		t.Errorf("Round trip changed output:\n%s\nwant\n%s", result, rendered)
+	}
+}
+
+func TestParseNix_IndentedStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Single line", "''hello''", "hello"},
+		{"Strips indentation", "''\n    first\n      second\n  ''", "first\n  second\n"},
+		{"Escapes", "''it'''s ''${HOME} ''\\n''", "it''s ${HOME} \n"},
+		{"Blank lines", "''\n  a\n\n  b''", "a\n\nb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := ParseNix(tt.input)
+			if err != nil {
+				t.Fatalf("parseNix() error = %v", err)
+			}
+			sv, ok := value.(StringValue)
+			if !ok {
+				t.Fatalf("parseNix() = %T, want StringValue", value)
+			}
+			if sv.Value != tt.expected {
+				t.Errorf("parseNix(%q) = %q, want %q", tt.input, sv.Value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseNix_Null(t *testing.T) {
+	value, err := ParseNix("{ a = null; b = [ null 1 ]; c = 2; }")
+	if err != nil {
+		t.Fatalf("parseNix() error = %v", err)
+	}
+	if result := value.ToNix(0); result != "{\n  b = [\n    1\n  ];\n  c = 2;\n}" {
+		t.Errorf("Expected null values to be skipped, got:\n%s", result)
+	}
+}
+
+// nixValue is a random Value that quick.Check can generate.
+type nixValue struct {
+	Value Value
+}
+
+var (
+	nixTestKeys = []string{
+		"autohide", "tilesize", "AppleInterfaceStyle", "autohide-delay", "NSWindow Frame Main",
+		"com.apple.dock", "1st", "with", "null", "\"NSNavPanelExpandedSizeForSaveMode\"",
+		"\"quoted key\"", "lastConnected@Display:2", "_private", "key'",
+	}
+	nixTestWords = []string{
+		"Dark", "left", "hello world", "0.2", "-5", "48", "1", "0", "1.0", "1e+20", "NaN", "inf",
+		"true", "false", "", "/Users/alice/Downloads", "file:///Applications/Safari.app/",
+		"com.apple.Safari", "say \"hi\" ", "C:\\ dir", "cost ${HOME} here", "tab\there x", "two\nlines ",
+		"2025-06-07 12:01:44 +0000", "x $ { y", "é ü ✓", "a;b = c",
+	}
+)
+
+func (nixValue) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(nixValue{generateValue(r, 3)})
+}
+
+func generateValue(r *rand.Rand, depth int) Value {
+	kind := r.Intn(4)
+	if depth == 0 {
+		kind = 0
+	}
+	switch kind {
+	case 1:
+		array := ArrayValue{Values: []Value{}}
+		for i := r.Intn(4); i > 0; i-- {
+			array.Values = append(array.Values, generateValue(r, depth-1))
+		}
+		return array
+	case 2, 3:
+		dict := DictValue{Values: make(map[string]Value), Order: []string{}}
+		for i := r.Intn(5); i > 0; i-- {
+			key := nixTestKeys[r.Intn(len(nixTestKeys))]
+			if _, exists := dict.Values[key]; exists {
+				continue
+			}
+			dict.Values[key] = generateValue(r, depth-1)
+			dict.Order = append(dict.Order, key)
+		}
+		return dict
+	default:
+		if r.Intn(2) == 0 {
+			return StringValue{Value: nixTestWords[r.Intn(len(nixTestWords))]}
+		}
+		return StringValue{Value: generateString(r)}
+	}
+}
+
+// nixTestRunes are the characters of generated strings, weighted towards
+// those that need escaping in Nix. There are no digits, since numbers are
+// meant to be written as Nix numbers.
+var nixTestRunes = []rune("aZ_-' \"\\${}\n\t\r;=./:@é✓")
+
+// generateString returns a random string of nixTestRunes.
+func generateString(r *rand.Rand) string {
+	var sb strings.Builder
+	for i := r.Intn(12); i > 0; i-- {
+		sb.WriteRune(nixTestRunes[r.Intn(len(nixTestRunes))])
+	}
+	return sb.String()
+}
+
+// TestParseNix_Property checks that parsing rendered output gives back the
+// rendered value: rendering it again yields the same text and no key differs.
+func TestParseNix_Property(t *testing.T) {
+	identity := func(v nixValue) bool {
+		rendered := v.Value.ToNix(0)
+		parsed, err := ParseNix(rendered)
+		if err != nil {
+			t.Logf("parseNix() error = %v\n%s", err, rendered)
+			return false
+		}
+		if again := parsed.ToNix(0); again != rendered {
+			t.Logf("Round trip changed output:\n%s\nwant\n%s", again, rendered)
+			return false
+		}
+		if changes := Diff(v.Value, parsed); len(changes) > 0 {
+			t.Logf("Round trip changed %d keys, first %s", len(changes), FormatChange("", changes[0]))
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(identity, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNixAttrPath(t *testing.T) {
+	tests := []struct {
+		path     []string
+		expected string
+	}{
+		{[]string{"NSGlobalDomain", "AppleLocale"}, "NSGlobalDomain.AppleLocale"},
+		{[]string{"com.apple.dock", "wvous-tl-corner"}, `"com.apple.dock".wvous-tl-corner`},
+		{[]string{"com.apple.Safari", "NSWindow Frame Main"}, `"com.apple.Safari"."NSWindow Frame Main"`},
+		{[]string{"com.example", "with"}, `"com.example"."with"`},
+	}
+	for _, tt := range tests {
+		if result := NixAttrPath(tt.path); result != tt.expected {
+			t.Errorf("NixAttrPath(%q) = %s, want %s", tt.path, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,1597 @@
+// Package plist converts the output of `defaults read` into Nix attribute
+// sets. Parse reads the old-style property list printed by `defaults read`
+// into a Value, leaving out the keys matched by the filters in Options, and
+// Render writes a Value as a Nix file for plain Nix, nix-darwin or
+// home-manager.
+package plist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Value interface {
+	ToNix(indent int) string
+}
+
+type SkipValue struct{}
+
+func (s SkipValue) ToNix(indent int) string {
+	return ""
+}
+
+// CommentValue annotates a value with a comment written after it.
+type CommentValue struct {
+	Value   Value
+	Comment string
+}
+
+func (c CommentValue) ToNix(indent int) string {
+	return c.Value.ToNix(indent)
+}
+
+// UnwrapComment returns the value wrapped by a CommentValue and its comment.
+func UnwrapComment(value Value) (Value, string) {
+	if c, ok := value.(CommentValue); ok {
+		return c.Value, c.Comment
+	}
+	return value, ""
+}
+
+type StringValue struct {
+	Value string
+	// HomeDir and HomeExpr, when set, make ToNix write occurrences of the
+	// home directory as a ${HomeExpr} interpolation instead of a literal path
+	HomeDir  string
+	HomeExpr string
+}
+
+func (s StringValue) ToNix(indent int) string {
+	if s.HomeDir != "" && s.HomeExpr != "" {
+		if segments := splitHomeDir(s.Value, s.HomeDir); len(segments) > 1 {
+			for i, segment := range segments {
+				segments[i] = escapeNixString(segment)
+			}
+			return fmt.Sprintf("\"%s\"", strings.Join(segments, "${"+s.HomeExpr+"}"))
+		}
+	}
+
+	// Handle special boolean cases
+	if s.Value == "1" {
+		return "true"
+	}
+	if s.Value == "0" {
+		return "false"
+	}
+
+	// Handle numeric values
+	if num, err := strconv.Atoi(s.Value); err == nil {
+		return strconv.Itoa(num)
+	}
+	// Strings such as "inf" and "NaN" parse as floats Nix can't express
+	if num, err := strconv.ParseFloat(s.Value, 64); err == nil && !math.IsInf(num, 0) && !math.IsNaN(num) {
+		return fmt.Sprintf("%.15g", num)
+	}
+
+	// Escape and quote strings
+	return fmt.Sprintf("\"%s\"", escapeNixString(s.Value))
+}
+
+func escapeNixString(s string) string {
+	escaped := strings.ReplaceAll(s, "\\", "\\\\")
+	escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
+	// Escape Nix string interpolation syntax ${...} → \${...}
+	escaped = strings.ReplaceAll(escaped, "${", "\\${")
+	return escaped
+}
+
+// splitHomeDir splits s around every occurrence of the home directory dir.
+// Occurrences must end the string or be followed by a path separator, so
+// /Users/alice does not match /Users/alicebob.
+func splitHomeDir(s, dir string) []string {
+	var segments []string
+	for {
+		idx := strings.Index(s, dir)
+		for idx >= 0 {
+			end := idx + len(dir)
+			if end == len(s) || s[end] == '/' {
+				break
+			}
+			next := strings.Index(s[end:], dir)
+			if next < 0 {
+				idx = -1
+				break
+			}
+			idx = end + next
+		}
+		if idx < 0 {
+			return append(segments, s)
+		}
+		segments = append(segments, s[:idx])
+		s = s[idx+len(dir):]
+	}
+}
+
+type ArrayValue struct {
+	Values []Value
+	config Options // Config for filtering elements
+}
+
+func (a ArrayValue) ToNix(indent int) string {
+	// Filter out SkipValue entries
+	var validValues []Value
+	for _, v := range a.Values {
+		inner, _ := UnwrapComment(v)
+		if _, isSkip := inner.(SkipValue); isSkip {
+			continue
+		}
+		validValues = append(validValues, v)
+	}
+
+	if len(validValues) == 0 {
+		return "[]"
+	}
+
+	indentStr := strings.Repeat("  ", indent)
+	nextIndentStr := strings.Repeat("  ", indent+1)
+
+	var parts []string
+	parts = append(parts, "[")
+
+	for _, v := range validValues {
+		line := nextIndentStr + v.ToNix(indent+1)
+		if _, comment := UnwrapComment(v); comment != "" {
+			line += " # " + comment
+		}
+		parts = append(parts, line)
+	}
+
+	parts = append(parts, indentStr+"]")
+	return strings.Join(parts, "\n")
+}
+
+type DictValue struct {
+	Values map[string]Value
+	Order  []string // Preserve order
+	config Options // Add config for filtering
+}
+
+// nixKeywords are names that must be quoted when used as attribute names.
+var nixKeywords = []string{
+	"with", "let", "in", "if", "then", "else", "assert", "rec",
+	"inherit", "or", "and", "import", "builtins", "throw", "abort",
+	"true", "false", "null",
+}
+
+func (d DictValue) ToNix(indent int) string {
+	if len(d.Values) == 0 {
+		return "{}"
+	}
+
+	indentStr := strings.Repeat("  ", indent)
+	nextIndentStr := strings.Repeat("  ", indent+1)
+
+	var parts []string
+	parts = append(parts, "{")
+
+	keys := d.Order
+	if len(keys) == 0 {
+		// Fall back to map iteration if no order preserved
+		for k := range d.Values {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, key := range keys {
+		value, exists := d.Values[key]
+		if !exists {
+			continue
+		}
+		value, comment := UnwrapComment(value)
+
+		// Skip binary data values
+		if _, isSkip := value.(SkipValue); isSkip {
+			continue
+		}
+
+		// Skip UI state keys if filtering is enabled
+		if d.config.NoState && isUIStateKey(key) {
+			continue
+		}
+
+		// Skip UUID keys if filtering is enabled
+		if d.config.NoUUIDs && isUUIDKey(key) {
+			continue
+		}
+
+		// Skip timestamp keys if date filtering is enabled
+		if d.config.NoDates && isTimestampKey(key) {
+			// Also check if the value looks like a timestamp
+			if sv, ok := value.(StringValue); ok {
+				// Check if it's a numeric timestamp
+				if num, err := strconv.ParseFloat(sv.Value, 64); err == nil {
+					if isUnixTimestamp(num) || isCFAbsoluteTime(num) {
+						continue
+					}
+				}
+			}
+			// For non-numeric values with timestamp keys, still skip them
+			continue
+		}
+
+		// Skip recent items and MRU lists if filtering is enabled
+		if d.config.NoRecents && isRecentsKey(key) && isRecentsValue(value) {
+			continue
+		}
+
+		// Skip app version bookkeeping if filtering is enabled
+		if d.config.NoVersions && isVersionKey(key) && (isVersionValue(value) || isBuildNumber(key, value)) {
+			continue
+		}
+
+		// Skip usage counters and telemetry if filtering is enabled
+		if d.config.NoUsage && isUsageKey(key) && isUsageValue(value) {
+			continue
+		}
+
+		nixKey := key
+		// Quote keys that need it
+		needsQuoting := false
+
+		// Check if key is purely numeric
+		if _, err := strconv.Atoi(key); err == nil {
+			needsQuoting = true
+		}
+
+		// Check if key starts with a number
+		if len(key) > 0 && key[0] >= '0' && key[0] <= '9' {
+			needsQuoting = true
+		}
+
+		// Check if key is a Nix reserved keyword
+		if slices.Contains(nixKeywords, key) {
+			needsQuoting = true
+		}
+
+		// Check for other characters that need quoting
+		if strings.Contains(key, " ") || strings.Contains(key, "-") ||
+			strings.Contains(key, ".") || strings.HasPrefix(key, "\"") {
+			needsQuoting = true
+		}
+
+		if needsQuoting && !strings.HasPrefix(key, "\"") {
+			nixKey = fmt.Sprintf("\"%s\"", strings.ReplaceAll(key, "\"", "\\\""))
+		}
+
+		valueStr := value.ToNix(indent + 1)
+		if strings.Contains(valueStr, "\n") {
+			// Add proper indentation to multiline values
+			parts = append(parts, fmt.Sprintf("%s%s = %s;", nextIndentStr, nixKey, valueStr))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s%s = %s;", nextIndentStr, nixKey, valueStr))
+		}
+		if comment != "" {
+			parts[len(parts)-1] += " # " + comment
+		}
+	}
+
+	parts = append(parts, indentStr+"}")
+	return strings.Join(parts, "\n")
+}
+
+// compareDictValues compares DictValue maps (since maps can't be compared directly with ==)
+func compareDictValues(m1, m2 map[string]Value) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for k, v1 := range m1 {
+		v2, ok := m2[k]
+		if !ok {
+			return false
+		}
+		// Recursively compare Value types
+		if !compareValues(v1, v2) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues deeply compares Value types. Key order and comments are
+// ignored, so values read at different times compare equal when their
+// contents are.
+func compareValues(v1, v2 Value) bool {
+	if c, ok := v1.(CommentValue); ok {
+		v1 = c.Value
+	}
+	if c, ok := v2.(CommentValue); ok {
+		v2 = c.Value
+	}
+
+	switch val1 := v1.(type) {
+	case StringValue:
+		val2, ok := v2.(StringValue)
+		return ok && val1.Value == val2.Value
+	case ArrayValue:
+		val2, ok := v2.(ArrayValue)
+		if !ok || len(val1.Values) != len(val2.Values) {
+			return false
+		}
+		for i := range val1.Values {
+			if !compareValues(val1.Values[i], val2.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case DictValue:
+		val2, ok := v2.(DictValue)
+		return ok && compareDictValues(val1.Values, val2.Values)
+	case SkipValue:
+		_, ok := v2.(SkipValue)
+		return ok
+	default:
+		return false
+	}
+}
+
+// Options control how defaults are parsed and which keys are left out.
+// The No fields are usually set through filters, see NewOptions.
+type Options struct {
+	NoDates      bool
+	NoState      bool
+	NoUUIDs      bool
+	NoSecrets    bool
+	NoUsage      bool
+	NoRecents    bool
+	NoVersions   bool
+	DropSecrets  bool         // Drop secrets instead of replacing them with a placeholder
+	DropVolatile bool         // Drop volatile keys instead of annotating them
+	Format       Format       // Nix configuration the output is written for
+	Home         HomeTemplate // Home directory templating, disabled when Dir is empty
+	Baseline     Value        // Values of a clean install keyed by domain, keys equal to them are left out
+}
+
+// A Filter leaves a kind of keys or values out of the output.
+type Filter func(*Options)
+
+// FilterDates leaves out dates and keys holding timestamps.
+func FilterDates() Filter { return func(o *Options) { o.NoDates = true } }
+
+// FilterState leaves out UI state such as window frames and split view sizes.
+func FilterState() Filter { return func(o *Options) { o.NoState = true } }
+
+// FilterUUIDs leaves out UUIDs, hashed identifiers and keys named after them.
+func FilterUUIDs() Filter { return func(o *Options) { o.NoUUIDs = true } }
+
+// FilterSecrets replaces tokens, passwords and keys with a placeholder, or
+// leaves them out when Options.DropSecrets is set.
+func FilterSecrets() Filter { return func(o *Options) { o.NoSecrets = true } }
+
+// FilterUsage leaves out usage counters, first-run flags and telemetry.
+func FilterUsage() Filter { return func(o *Options) { o.NoUsage = true } }
+
+// FilterRecents leaves out recent items, MRU lists and bookmarks.
+func FilterRecents() Filter { return func(o *Options) { o.NoRecents = true } }
+
+// FilterVersions leaves out app version bookkeeping.
+func FilterVersions() Filter { return func(o *Options) { o.NoVersions = true } }
+
+// ParseFilter returns the filter called name, as accepted by the -filter
+// flag: dates, state, uuids, secrets, usage, recents or versions.
+func ParseFilter(name string) (Filter, error) {
+	switch strings.TrimSpace(strings.ToLower(name)) {
+	case "dates":
+		return FilterDates(), nil
+	case "state":
+		return FilterState(), nil
+	case "uuids":
+		return FilterUUIDs(), nil
+	case "secrets":
+		return FilterSecrets(), nil
+	case "usage":
+		return FilterUsage(), nil
+	case "recents":
+		return FilterRecents(), nil
+	case "versions":
+		return FilterVersions(), nil
+	}
+	return nil, fmt.Errorf("Unknown filter option '%s'. Valid options are: dates, state, uuids, secrets, usage, recents, versions", name)
+}
+
+// NewOptions returns options for plain output with the filters applied.
+func NewOptions(filters ...Filter) Options {
+	options := Options{Format: FormatPlain}
+	for _, filter := range filters {
+		filter(&options)
+	}
+	return options
+}
+
+// Parse reads the output of `defaults read <domain>` from r, or of
+// `defaults read` for all domains when domain is empty, and returns its
+// value with the keys and values matched by the filters in options left out
+// and secrets redacted.
+func Parse(r io.Reader, domain string, options Options) (Value, error) {
+	converted, err := ConvertDomain(r, domain, options, nil)
+	if err != nil {
+		return nil, err
+	}
+	return converted.Value, nil
+}
+
+// Render writes value to w as the contents of a Nix file written for
+// format. When home directory templating produced any interpolation, the
+// attribute set is wrapped in a function providing the home directory.
+func Render(w io.Writer, value Value, format Format) error {
+	_, err := io.WriteString(w, render(value, format))
+	return err
+}
+
+func render(value Value, format Format) string {
+	result := value.ToNix(0)
+	for _, expr := range homeExprs(value) {
+		if strings.Contains(result, "${"+expr+"}") {
+			return homeArgs(format) + "\n" + result
+		}
+	}
+	return result
+}
+
+// homeExprs returns the home directory expressions used by the strings in
+// value.
+func homeExprs(value Value) []string {
+	value, _ = UnwrapComment(value)
+	switch v := value.(type) {
+	case StringValue:
+		if v.HomeDir != "" && v.HomeExpr != "" {
+			return []string{v.HomeExpr}
+		}
+	case ArrayValue:
+		var exprs []string
+		for _, child := range v.Values {
+			exprs = append(exprs, homeExprs(child)...)
+		}
+		return exprs
+	case DictValue:
+		var exprs []string
+		for _, child := range v.Values {
+			exprs = append(exprs, homeExprs(child)...)
+		}
+		return exprs
+	}
+	return nil
+}
+
+// Format is the kind of Nix configuration the output is written for.
+type Format string
+
+const (
+	FormatPlain       Format = "plain"
+	FormatDarwin      Format = "darwin"
+	FormatHomeManager Format = "home-manager"
+)
+
+// ParseFormat returns the format called s, as accepted by the -format flag.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatPlain, FormatDarwin, FormatHomeManager:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("Unknown format option '%s'. Valid options are: plain, darwin, home-manager", s)
+}
+
+// HomeTemplate describes how paths below the home directory are written
+// when -templatize-home is used.
+type HomeTemplate struct {
+	Dir  string // Home directory to replace, e.g. /Users/alice
+	Expr string // Nix expression interpolated in its place
+	Args string // Function header that brings Expr into scope
+}
+
+// NewHomeTemplate returns the home directory templating for format. Plain
+// output takes the home directory as an argument, while nix-darwin and Home
+// Manager output refer to it through the module configuration.
+func NewHomeTemplate(dir string, format Format) HomeTemplate {
+	dir = strings.TrimSuffix(dir, "/")
+	switch format {
+	case FormatDarwin:
+		user := filepath.Base(dir)
+		if !isNixIdentifier(user) {
+			user = "\"" + escapeNixString(user) + "\""
+		}
+		return HomeTemplate{Dir: dir, Expr: "config.users.users." + user + ".home", Args: homeArgs(format)}
+	case FormatHomeManager:
+		return HomeTemplate{Dir: dir, Expr: "config.home.homeDirectory", Args: homeArgs(format)}
+	default:
+		return HomeTemplate{Dir: dir, Expr: "home", Args: homeArgs(format)}
+	}
+}
+
+// homeArgs returns the function header that brings the home directory
+// expression for format into scope.
+func homeArgs(format Format) string {
+	if format == FormatDarwin || format == FormatHomeManager {
+		return "{ config, ... }:"
+	}
+	return "{ home }:"
+}
+
+// isNixIdentifier reports whether s can be used as an attribute name
+// without quoting.
+func isNixIdentifier(s string) bool {
+	if s == "" || slices.Contains(nixKeywords, s) {
+		return false
+	}
+	for i, c := range s {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+		if i == 0 && !isLetter {
+			return false
+		}
+		if !isLetter && !(c >= '0' && c <= '9') && c != '-' && c != '\'' {
+			return false
+		}
+	}
+	return true
+}
+
+func isBinaryDataValue(input string) bool {
+	// More robust binary data detection
+	// Binary data values can have the patterns:
+	// {length = N, bytes = 0x...} (comma-separated)
+	// {length = N; bytes = 0x...;} (semicolon-separated)
+	
+	// Must contain both "length =" and "bytes =" 
+	if !strings.Contains(input, "length =") || !strings.Contains(input, "bytes =") {
+		return false
+	}
+	
+	// Check for the specific hex bytes pattern
+	if !strings.Contains(input, "bytes = 0x") {
+		return false
+	}
+	
+	// Parse the content to ensure it only contains length and bytes keys
+	content := strings.TrimSpace(input[1 : len(input)-1]) // Remove braces
+	
+	// Try both comma and semicolon separators
+	var parts []string
+	if strings.Contains(content, ";") {
+		parts = strings.Split(content, ";")
+	} else {
+		parts = strings.Split(content, ",")
+	}
+	
+	validKeys := 0
+	
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		
+		if strings.HasPrefix(part, "length =") || strings.HasPrefix(part, "bytes = 0x") {
+			validKeys++
+		} else {
+			// Found a key that's not length or bytes, so this isn't binary data
+			return false
+		}
+	}
+	
+	// Should have exactly 2 valid keys (length and bytes)
+	return validKeys == 2
+}
+
+func isUIStateKey(key string) bool {
+	// UI state and window geometry that's typically not useful for Nix config
+	statePatterns := []string{
+		"NSWindow Frame ",
+		"NSSplitView Subview Frames ",
+		"NSNavPanelExpandedSize",
+		"NSNavPanelFileLastListMode",
+		"NSNavPanelFileListMode",
+		"NSTableView Columns ",
+		"NSTableView Sort Ordering ",
+		"NSTableView Supports ",
+		"Column Width",
+		"UserColumnSortPerTab",
+		"UserColumnsPerTab",
+		"TB Icon Size Mode",
+		"TB Size Mode",
+		"image window frame",
+		"image window parent frame",
+		"NSPreferencesContentSize",
+	}
+	
+	for _, pattern := range statePatterns {
+		if strings.Contains(key, pattern) {
+			return true
+		}
+	}
+	
+	// NSToolbar configurations - these are UI state
+	if strings.Contains(key, "NSToolbar Configuration") ||
+		strings.Contains(key, "ExtensionsToolbarConfiguration") {
+		return true
+	}
+	
+	// Crop rectangles and other UI geometry (but be more specific)
+	if strings.Contains(key, "CropRect") {
+		return true
+	}
+	
+	// Window frames that don't start with NSWindow Frame
+	if strings.HasSuffix(key, "Frame") && 
+		(strings.Contains(key, "Window") || strings.Contains(key, "window")) {
+		return true
+	}
+	
+	// Cache and temporary data
+	if strings.Contains(key, "cache") || strings.Contains(key, "Cache") {
+		return true
+	}
+	
+	return false
+}
+
+func isUIStateValue(value string) bool {
+	// NSRect format: {{x, y}, {width, height}}
+	if strings.HasPrefix(value, "{{") && strings.HasSuffix(value, "}}") {
+		return true
+	}
+	
+	// NSSize format: {width, height}  
+	if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") && 
+		strings.Count(value, ",") == 1 && !strings.Contains(value, "=") {
+		return true
+	}
+	
+	// Window frame format: 8 space-separated numbers
+	parts := strings.Fields(value)
+	if len(parts) == 8 {
+		allNumbers := true
+		for _, part := range parts {
+			if _, err := strconv.ParseFloat(part, 64); err != nil {
+				allNumbers = false
+				break
+			}
+		}
+		if allNumbers {
+			return true
+		}
+	}
+	
+	// Split view frame format: 6 comma-separated values ending with NO/YES
+	if strings.Count(value, ",") == 5 && 
+		(strings.HasSuffix(strings.TrimSpace(value), "NO") || 
+		 strings.HasSuffix(strings.TrimSpace(value), "YES")) {
+		return true
+	}
+	
+	return false
+}
+
+func isDateString(s string) bool {
+	// Common date patterns in macOS defaults
+	// Simple heuristic: check for YYYY-MM-DD pattern
+	if len(s) < 10 {
+		return false
+	}
+
+	// Check for date patterns
+	// Standard macOS format: 2025-06-07 12:01:44 +0000
+	// ISO 8601: 2025-06-07T12:01:44Z
+	// Date only: 2025-06-07
+
+	// Must contain at least YYYY-MM-DD pattern
+	if len(s) >= 10 && s[4] == '-' && s[7] == '-' {
+		// Check if first 4 chars are digits (year) and validate range
+		year := 0
+		for i := 0; i < 4; i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return false
+			}
+			year = year*10 + int(s[i]-'0')
+		}
+		if year < 1900 || year > 2100 {
+			return false
+		}
+		
+		// Check if chars 5-6 are digits and form valid month (01-12)
+		if s[5] < '0' || s[5] > '9' || s[6] < '0' || s[6] > '9' {
+			return false
+		}
+		month := int(s[5]-'0')*10 + int(s[6]-'0')
+		if month < 1 || month > 12 {
+			return false
+		}
+		
+		// Check if chars 8-9 are digits and form valid day (01-31)
+		if s[8] < '0' || s[8] > '9' || s[9] < '0' || s[9] > '9' {
+			return false
+		}
+		day := int(s[8]-'0')*10 + int(s[9]-'0')
+		if day < 1 || day > 31 {
+			return false
+		}
+		
+		// If we have exactly 10 chars, it's a date-only format
+		if len(s) == 10 {
+			return true
+		}
+		
+		// For longer strings, check if char 10 is a separator (space or 'T')
+		if len(s) > 10 && (s[10] == ' ' || s[10] == 'T') {
+			// Additional validation for time portion if present
+			if s[10] == ' ' && len(s) >= 19 {
+				// Check HH:MM:SS format at positions 11-18
+				timepart := s[11:19]
+				if len(timepart) == 8 && timepart[2] == ':' && timepart[5] == ':' {
+					// Validate time digits
+					for _, pos := range []int{0, 1, 3, 4, 6, 7} {
+						if timepart[pos] < '0' || timepart[pos] > '9' {
+							return false
+						}
+					}
+					hours := int(timepart[0]-'0')*10 + int(timepart[1]-'0')
+					minutes := int(timepart[3]-'0')*10 + int(timepart[4]-'0')
+					seconds := int(timepart[6]-'0')*10 + int(timepart[7]-'0')
+					if hours > 23 || minutes > 59 || seconds > 59 {
+						return false
+					}
+				}
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+func isUUIDString(s string) bool {
+	// UUID v4 format: XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX
+	// where X is a hexadecimal digit
+	if len(s) != 36 {
+		return false
+	}
+	
+	// Check hyphens at expected positions
+	if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return false
+	}
+	
+	// Check that all other characters are hex digits
+	for i, c := range s {
+		// Skip hyphen positions
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			continue
+		}
+		
+		// Must be a hex digit (0-9, a-f, A-F)
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	
+	return true
+}
+
+func isHashedIDString(s string) bool {
+	// Check for underscore-prefixed hex identifiers like "_19a3bc4999bddb89e1a44f4b87bdc37c"
+	// These appear to be 32-character hex strings (possibly MD5 hashes)
+	if len(s) < 2 || s[0] != '_' {
+		return false
+	}
+	
+	// Check if the rest is a 32-character hex string
+	hexPart := s[1:]
+	if len(hexPart) != 32 {
+		return false
+	}
+	
+	// Check that all characters are hex digits
+	for _, c := range hexPart {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	
+	return true
+}
+
+func isUUIDKey(key string) bool {
+	// Check if the key itself is a UUID
+	if isUUIDString(key) {
+		return true
+	}
+	
+	// Check if the key contains a UUID (common pattern: prefix-UUID-suffix)
+	if len(key) >= 36 {
+		// Look for UUID pattern within the key
+		for i := 0; i <= len(key)-36; i++ {
+			if isUUIDString(key[i:i+36]) {
+				return true
+			}
+		}
+	}
+	
+	return false
+}
+
+func isTimestampKey(key string) bool {
+	// Convert key to lowercase for case-insensitive matching
+	lowerKey := strings.ToLower(key)
+	
+	// Common timestamp-related patterns in keys
+	timestampPatterns := []string{
+		"time", "timestamp", "date", "epoch",
+		"updated", "created", "modified", "changed",
+		"lastused", "lastseen", "lastaccess", "lastconnected",
+		"lastunseen", "lastvisit", "lastopen", "lastlaunch",
+		"accessed", "visited", "opened", "launched",
+		"expiry", "expires", "expired", "expiration",
+		"checkedat", "setat", "startedat", "endedat",
+		"since", "until", "when", "at",
+	}
+	
+	// Check if the key contains any timestamp-related pattern
+	for _, pattern := range timestampPatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+	
+	// Check for patterns like "connected@", "seen@" etc.
+	if strings.Contains(key, "@") && (strings.Contains(lowerKey, "connected") || 
+		strings.Contains(lowerKey, "seen") || strings.Contains(lowerKey, "accessed")) {
+		return true
+	}
+	
+	return false
+}
+
+func isUnixTimestamp(value float64) bool {
+	// Unix timestamps for dates between 2000 and 2040
+	// 2000-01-01: 946684800
+	// 2040-01-01: 2208988800
+	return value >= 946684800 && value <= 2208988800
+}
+
+func isCFAbsoluteTime(value float64) bool {
+	// CFAbsoluteTime for dates between 2000 and 2040
+	// Seconds since 2001-01-01
+	// 2000-01-01 from 2001-01-01: -31536000 (negative)
+	// 2040-01-01 from 2001-01-01: 1230768000
+	// Also require a minimum value to avoid small numbers
+	return value >= 100000000 && value <= 1230768000
+}
+
+func isUsageKey(key string) bool {
+	// Convert key to lowercase for case-insensitive matching
+	lowerKey := strings.ToLower(UnquoteKey(key))
+
+	// Keys like ShowLaunchCount or DisplayTipCount choose what is shown
+	for _, prefix := range []string{"show", "hide", "display", "enable"} {
+		if strings.HasPrefix(lowerKey, prefix) {
+			return false
+		}
+	}
+
+	// Tallies like LaunchCount or WelcomeTipShownCount
+	tallySuffixes := []string{"launchcount", "runcount", "showncount", "seencount", "usagecount"}
+	for _, suffix := range tallySuffixes {
+		if strings.HasSuffix(lowerKey, suffix) {
+			return true
+		}
+	}
+
+	// NumberOfTimesLaunched, SUHasLaunchedBefore, FirstRunDate and
+	// onboarding bookkeeping
+	usagePatterns := []string{
+		"numberoftimeslaunched", "numberoftimesshown", "numberoftimesrun", "numberoftimesseen", "numberoftimesopened",
+		"haslaunchedbefore", "hasshownbefore", "hasrunbefore", "hasseenbefore",
+		"firstrundate", "firstlaunchdate",
+		"completedonboarding", "completeonboarding", "onboardingcomplete",
+	}
+	for _, pattern := range usagePatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+
+	// Analytics identifiers like AnalyticsInstallID, but not opt-outs like
+	// SendAnalytics
+	if strings.Contains(lowerKey, "analytics") || strings.Contains(lowerKey, "telemetry") {
+		for _, suffix := range []string{"id", "uuid", "identifier"} {
+			if strings.HasSuffix(lowerKey, suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isUsageValue(value Value) bool {
+	sv, ok := value.(StringValue)
+	if !ok {
+		// Usage bookkeeping is scalar; nested structures are configuration
+		return false
+	}
+
+	// Counters, flags and timestamps
+	if _, err := strconv.ParseFloat(sv.Value, 64); err == nil {
+		return true
+	}
+	if isBooleanString(sv.Value) || isDateString(sv.Value) {
+		return true
+	}
+
+	// Analytics and installation identifiers
+	return isUUIDString(sv.Value) || isHashedIDString(sv.Value)
+}
+
+func isRecentsKey(key string) bool {
+	// Convert key to lowercase for case-insensitive matching
+	lowerKey := strings.ToLower(key)
+
+	// Recent documents, histories and last-used locations
+	recentsPatterns := []string{
+		"recent", "history", "mru",
+		"lastopened", "lastfolder", "lastdirectory", "lastrootdirectory",
+		"lastcurrentdirectory", "lastlocation", "lastsavedirectory",
+		"lastbrowsed", "previoussearch", "searchterms",
+	}
+
+	for _, pattern := range recentsPatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isRecentsValue(value Value) bool {
+	// Recents are lists, bookmark records or locations; scalar settings
+	// such as ShowRecentTags = 1 or HistoryAgeInDaysLimit = 365 are kept
+	switch v := value.(type) {
+	case ArrayValue, DictValue:
+		return true
+	case StringValue:
+		return isPathOrURL(v.Value)
+	}
+	return false
+}
+
+func isPathOrURL(value string) bool {
+	if strings.HasPrefix(value, "/") || strings.HasPrefix(value, "~/") {
+		return true
+	}
+	// file://, smb://, afp://, vnc://, https:// and similar locations
+	scheme, _, found := strings.Cut(value, "://")
+	if !found || scheme == "" {
+		return false
+	}
+	for _, c := range scheme {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func isVersionKey(key string) bool {
+	// Convert key to lowercase for case-insensitive matching
+	lowerKey := strings.ToLower(UnquoteKey(key))
+
+	// Sparkle update bookkeeping, recorded whatever the value looks like
+	sparkleKeys := []string{"sulastchecktime", "sulastprofilesubmissiondate", "suskippedversion"}
+	if slices.Contains(sparkleKeys, lowerKey) {
+		return true
+	}
+
+	// LastVersionRun, CFBundleVersion, WhatsNewShownVersion, lastSeenBuild
+	if strings.Contains(lowerKey, "version") || strings.Contains(lowerKey, "whatsnew") {
+		return true
+	}
+
+	// Build numbers, without matching settings like BuildLocationStyle
+	buildPatterns := []string{"buildnumber", "buildversion", "lastbuild"}
+	for _, pattern := range buildPatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+	return strings.HasSuffix(lowerKey, "build")
+}
+
+func isVersionValue(value Value) bool {
+	sv, ok := value.(StringValue)
+	if !ok {
+		return false
+	}
+
+	// Sparkle stores the time of the last update check
+	if isDateString(sv.Value) {
+		return true
+	}
+
+	return semverPattern.MatchString(sv.Value) || appleBuildPattern.MatchString(sv.Value)
+}
+
+// isBuildNumber reports whether value is a plain build number like
+// CFBundleVersion = 1234 stored under a bookkeeping key. Small numbers and
+// numbers under other version keys, like PreferredVersion = 2 or
+// ShowVersionInTitleBar = 1, are settings.
+func isBuildNumber(key string, value Value) bool {
+	sv, ok := value.(StringValue)
+	if !ok || len(sv.Value) < 2 || isBooleanString(sv.Value) {
+		return false
+	}
+	if _, err := strconv.Atoi(sv.Value); err != nil {
+		return false
+	}
+
+	// LastVersionRun, lastSeenBuild, WhatsNewShownVersion, CFBundleVersion
+	lowerKey := strings.ToLower(UnquoteKey(key))
+	if strings.HasPrefix(lowerKey, "last") || strings.HasPrefix(lowerKey, "sulast") {
+		return true
+	}
+	bookkeepingPatterns := []string{"seen", "shown", "whatsnew", "cfbundleversion"}
+	for _, pattern := range bookkeepingPatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretPlaceholder replaces values redacted by the secrets filter.
+const secretPlaceholder = "<redacted>"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`^eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*$`)
+
+	// 1.2, 1.2.3, v2.0.1-beta.1, 1.2.3 (456)
+	semverPattern = regexp.MustCompile(`^v?\d+(\.\d+){1,3}([-+][0-9A-Za-z.-]+)?( \(\w+\))?$`)
+	// macOS and iOS style build numbers like 21F79 or 23A344b
+	appleBuildPattern = regexp.MustCompile(`^\d{1,2}[A-Z]\d{1,5}[a-z]?$`)
+)
+
+func isSecretKey(key string) bool {
+	lowerKey := strings.ToLower(key)
+
+	// Credentials, license data and personal identifiers
+	secretPatterns := []string{
+		"token", "password", "passwd", "secret", "apikey", "api_key",
+		"credential", "license", "licence", "serial", "email", "account",
+	}
+
+	for _, pattern := range secretPatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSecretValue(value string) bool {
+	// JSON Web Tokens: three base64url segments, the header starting with {"
+	if jwtPattern.MatchString(value) {
+		return true
+	}
+
+	// Email addresses anywhere in the value, e.g. "Jane <jane@example.com>"
+	if emailPattern.MatchString(value) {
+		return true
+	}
+
+	return isHighEntropyString(value)
+}
+
+func isHighEntropyString(s string) bool {
+	// API keys and license codes are long runs of mixed letters and digits.
+	// Paths, URLs, bundle identifiers and prose contain separators that
+	// random tokens do not, and UUIDs are left to the uuids filter.
+	if len(s) < 20 || isUUIDString(s) {
+		return false
+	}
+	if strings.ContainsAny(s, " ./:") {
+		return false
+	}
+
+	hasLetter, hasDigit := false, false
+	for _, c := range s {
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			hasLetter = true
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return false
+	}
+
+	return shannonEntropy(s) >= 3.5
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, c := range s {
+		counts[c]++
+		total++
+	}
+
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// isBooleanString reports whether value is one of the boolean spellings used
+// by `defaults read`. Flags such as RememberPassword = 1 are never secret.
+func isBooleanString(value string) bool {
+	switch value {
+	case "0", "1", "YES", "NO", "true", "false":
+		return true
+	}
+	return false
+}
+
+// isNumericString reports whether value renders as a Nix number. Numbers
+// under secret key names, such as AccountSyncInterval = 30, are settings, and
+// a string placeholder would change their type.
+func isNumericString(value string) bool {
+	if _, err := strconv.Atoi(value); err == nil {
+		return true
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	return err == nil && !math.IsInf(num, 0) && !math.IsNaN(num)
+}
+
+// redactSecrets replaces values that look like credentials or personal data
+// with secretPlaceholder, or drops them when drop is set. domain is used to
+// report key paths; an empty domain means value is keyed by domain. It
+// returns the redacted key paths in "domain:path" form.
+func redactSecrets(value Value, domain string, drop bool) (Value, []string) {
+	var redacted []string
+	report := func(path []string) {
+		redacted = append(redacted, FormatDomainPath(domain, path))
+	}
+
+	// Top-level keys of `defaults read` for all domains are domain names,
+	// which must not be mistaken for secret key names
+	if dict, ok := value.(DictValue); ok && domain == "" {
+		result := DictValue{Values: make(map[string]Value), Order: dict.Order, config: dict.config}
+		for _, key := range DictKeys(dict) {
+			if child, exists := dict.Values[key]; exists {
+				result.Values[key] = redactValue(child, []string{UnquoteKey(key)}, false, drop, report)
+			}
+		}
+		return result, redacted
+	}
+
+	return redactValue(value, nil, false, drop, report), redacted
+}
+
+func redactValue(value Value, path []string, secretKey, drop bool, report func([]string)) Value {
+	switch v := value.(type) {
+	case DictValue:
+		result := DictValue{Values: make(map[string]Value), Order: v.Order, config: v.config}
+		for _, key := range DictKeys(v) {
+			child, exists := v.Values[key]
+			if !exists {
+				continue
+			}
+			name := UnquoteKey(key)
+			childPath := append(slices.Clone(path), name)
+			result.Values[key] = redactValue(child, childPath, secretKey || isSecretKey(name), drop, report)
+		}
+		return result
+	case ArrayValue:
+		result := ArrayValue{Values: make([]Value, 0, len(v.Values)), config: v.config}
+		for i, child := range v.Values {
+			childPath := append(slices.Clone(path), strconv.Itoa(i))
+			result.Values = append(result.Values, redactValue(child, childPath, secretKey, drop, report))
+		}
+		return result
+	case CommentValue:
+		inner := redactValue(v.Value, path, secretKey, drop, report)
+		if _, isSkip := inner.(SkipValue); isSkip {
+			return inner
+		}
+		return CommentValue{Value: inner, Comment: v.Comment}
+	case StringValue:
+		if isBooleanString(v.Value) || !((secretKey && !isNumericString(v.Value)) || isSecretValue(v.Value)) {
+			return v
+		}
+		report(path)
+		if drop {
+			return SkipValue{}
+		}
+		return StringValue{Value: secretPlaceholder}
+	default:
+		return value
+	}
+}
+
+func parseValue(input string) Value {
+	return parseValueWithConfig(input, Options{})
+}
+
+func parseValueWithConfig(input string, config Options) Value {
+	input = strings.TrimSpace(input)
+
+	// Handle arrays (parentheses)
+	if strings.HasPrefix(input, "(") && strings.HasSuffix(input, ")") {
+		return parseArrayWithConfig(input, config)
+	}
+
+	// Handle dictionaries (braces)
+	if strings.HasPrefix(input, "{") && strings.HasSuffix(input, "}") {
+		// Check if this is a binary data value - skip binary data as it's not useful in Nix
+		if isBinaryDataValue(input) {
+			return SkipValue{}
+		}
+		dictValue := parseDictWithConfig(input, config)
+		dictValue.config = config // Ensure config is set
+		return dictValue
+	}
+
+	// Handle quoted strings - remove quotes and unescape
+	if strings.HasPrefix(input, "\"") && strings.HasSuffix(input, "\"") && len(input) > 1 {
+		unescaped := input[1 : len(input)-1]
+		// Unescape the string content
+		unescaped = strings.ReplaceAll(unescaped, "\\\"", "\"")
+		unescaped = strings.ReplaceAll(unescaped, "\\\\", "\\")
+
+		return parseScalarWithConfig(unescaped, config)
+	}
+
+	// Everything else is a string value
+	return parseScalarWithConfig(input, config)
+}
+
+// parseScalarWithConfig returns the value of a string or number, or
+// SkipValue when it is filtered out.
+func parseScalarWithConfig(input string, config Options) Value {
+	// Check if this is a date and should be skipped
+	if config.NoDates && isDateString(input) {
+		return SkipValue{}
+	}
+
+	// Check if this is UI state and should be skipped
+	if config.NoState && isUIStateValue(input) {
+		return SkipValue{}
+	}
+
+	// Check if this is a UUID and should be skipped
+	if config.NoUUIDs && (isUUIDString(input) || isHashedIDString(input)) {
+		return SkipValue{}
+	}
+
+	return newStringValue(input, config)
+}
+
+func newStringValue(value string, config Options) StringValue {
+	if config.Home.Dir != "" && strings.Contains(value, config.Home.Dir) {
+		return StringValue{Value: value, HomeDir: config.Home.Dir, HomeExpr: config.Home.Expr}
+	}
+	return StringValue{Value: value}
+}
+
+func parseArray(input string) ArrayValue {
+	return parseArrayWithConfig(input, Options{})
+}
+
+func parseArrayWithConfig(input string, config Options) ArrayValue {
+	content := input[1 : len(input)-1] // Remove outer parentheses
+	content = strings.TrimSpace(content)
+
+	if content == "" {
+		return ArrayValue{Values: []Value{}, config: config}
+	}
+
+	values := parseArrayElementsWithConfig(content, config)
+	return ArrayValue{Values: values, config: config}
+}
+
+func parseArrayElements(content string) []Value {
+	return parseArrayElementsWithConfig(content, Options{})
+}
+
+func parseArrayElementsWithConfig(content string, config Options) []Value {
+	var values []Value
+	var current strings.Builder
+	var depth int
+	var inQuotes bool
+	var escape bool
+
+	runes := []rune(content)
+	for i := range runes {
+		char := runes[i]
+
+		if escape {
+			current.WriteRune(char)
+			escape = false
+			continue
+		}
+
+		if char == '\\' {
+			escape = true
+			current.WriteRune(char)
+			continue
+		}
+
+		if char == '"' {
+			inQuotes = !inQuotes
+			current.WriteRune(char)
+			continue
+		}
+
+		if !inQuotes {
+			switch char {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+			}
+
+			if char == ',' && depth == 0 {
+				val := strings.TrimSpace(current.String())
+				val = strings.TrimSuffix(val, ";")
+				if val != "" {
+					values = append(values, parseValueWithConfig(val, config))
+				}
+				current.Reset()
+				continue
+			}
+		}
+
+		current.WriteRune(char)
+	}
+
+	// Handle the last element
+	val := strings.TrimSpace(current.String())
+	val = strings.TrimSuffix(val, ";")
+	if val != "" {
+		values = append(values, parseValueWithConfig(val, config))
+	}
+
+	return values
+}
+
+func parseDict(input string) DictValue {
+	return parseDictWithConfig(input, Options{})
+}
+
+func parseDictWithConfig(input string, config Options) DictValue {
+	content := input[1 : len(input)-1] // Remove outer braces
+	content = strings.TrimSpace(content)
+
+	if content == "" {
+		return DictValue{Values: make(map[string]Value), Order: []string{}, config: config}
+	}
+
+	values := make(map[string]Value)
+	var order []string
+	for _, entry := range dictEntries(content) {
+		values[entry.key] = parseValueWithConfig(entry.value, config)
+		order = append(order, entry.key)
+	}
+	return DictValue{Values: values, Order: order, config: config}
+}
+
+// dictEntry is a key of a dictionary with the unparsed text of its value.
+type dictEntry struct {
+	key   string
+	value string
+}
+
+// dictEntries splits the content of a dictionary, without the outer
+// braces, into its entries.
+func dictEntries(content string) []dictEntry {
+	var entries []dictEntry
+
+	// Parse using a character-by-character approach to handle nested structures
+	var currentKey string
+	var currentValue strings.Builder
+	var inKey = true
+	var depth int
+	var inQuotes bool
+	var escape bool
+
+	runes := []rune(content)
+	i := 0
+
+	for i < len(runes) {
+		char := runes[i]
+
+		if escape {
+			currentValue.WriteRune(char)
+			escape = false
+			i++
+			continue
+		}
+
+		if char == '\\' {
+			escape = true
+			currentValue.WriteRune(char)
+			i++
+			continue
+		}
+
+		if char == '"' {
+			inQuotes = !inQuotes
+			if inKey {
+				currentKey += string(char)
+			} else {
+				currentValue.WriteRune(char)
+			}
+			i++
+			continue
+		}
+
+		if !inQuotes {
+			if inKey {
+				if char == '=' && i+2 < len(runes) && runes[i+1] == ' ' {
+					// Found key = value separator
+					currentKey = strings.TrimSpace(currentKey)
+					inKey = false
+					i += 2 // Skip " = "
+					continue
+				} else {
+					currentKey += string(char)
+				}
+			} else {
+				// In value
+				switch char {
+				case '{', '(':
+					depth++
+				case '}', ')':
+					depth--
+				}
+
+				if char == ';' && depth == 0 {
+					// End of value
+					valueStr := strings.TrimSpace(currentValue.String())
+					entries = append(entries, dictEntry{currentKey, valueStr})
+
+					// Reset for next key-value pair
+					currentKey = ""
+					currentValue.Reset()
+					inKey = true
+
+					// Skip whitespace after semicolon
+					i++
+					for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t' || runes[i] == '\n' || runes[i] == '\r') {
+						i++
+					}
+					continue
+				} else {
+					currentValue.WriteRune(char)
+				}
+			}
+		} else {
+			// Inside quotes
+			if inKey {
+				currentKey += string(char)
+			} else {
+				currentValue.WriteRune(char)
+			}
+		}
+
+		i++
+	}
+
+	// Handle the last key-value pair if it doesn't end with semicolon
+	if currentKey != "" && currentValue.Len() > 0 {
+		valueStr := strings.TrimSpace(currentValue.String())
+		entries = append(entries, dictEntry{currentKey, valueStr})
+	}
+
+	return entries
+}
+
+func convertDefaults(input io.Reader) (string, error) {
+	return convertDefaultsWithConfig(input, Options{})
+}
+
+func convertDefaultsWithConfig(input io.Reader, config Options) (string, error) {
+	scanner := bufio.NewScanner(input)
+	var content strings.Builder
+
+	for scanner.Scan() {
+		content.WriteString(scanner.Text() + "\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	inputStr := strings.TrimSpace(content.String())
+	value := parseValueWithConfig(inputStr, config)
+	return value.ToNix(0), nil
+}
+
+func convertDefaultsWithValue(inputStr string) (string, Value, error) {
+	return convertDefaultsWithValueAndConfig(inputStr, Options{})
+}
+
+func convertDefaultsWithValueAndConfig(inputStr string, config Options) (string, Value, error) {
+	value := parseValueWithConfig(inputStr, config)
+	return value.ToNix(0), value, nil
+}
+
+// Conversion is the result of converting the defaults of a domain.
+type Conversion struct {
+	Value    Value
+	Redacted []string // Key paths redacted by the secrets filter
+	Volatile []string // Key paths whose value changed between samples
+}
+
+// ConvertDomain parses raw `defaults read` output for domain, or for all
+// domains when domain is empty, keeps only the key paths matched by the
+// selection queries when any are given and redacts secrets when enabled.
+func ConvertDomain(input io.Reader, domain string, config Options, queries []SelectQuery) (Conversion, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return Conversion{}, err
+	}
+	return ConvertSamples([][]byte{data}, domain, config, queries)
+}
+
+// ConvertSamples converts several samples of the same `defaults read`
+// output, oldest first, like ConvertDomain. Keys whose value changed between
+// samples are volatile: they are annotated with a comment, or dropped when
+// config.DropVolatile is set. Keys equal to config.Baseline are left out.
+func ConvertSamples(samples [][]byte, domain string, config Options, queries []SelectQuery) (Conversion, error) {
+	values := make([]Value, 0, len(samples))
+	for _, data := range samples {
+		values = append(values, parseValueWithConfig(strings.TrimSpace(string(data)), config))
+	}
+	return ConvertValues(values, domain, config, queries)
+}
+
+// ConvertValues is ConvertSamples for samples that were already parsed.
+func ConvertValues(values []Value, domain string, config Options, queries []SelectQuery) (Conversion, error) {
+	value, volatilePaths := markVolatile(values, config.DropVolatile)
+	var volatile []string
+	for _, path := range volatilePaths {
+		volatile = append(volatile, FormatDomainPath(domain, path))
+	}
+
+	if config.Baseline != nil {
+		value = stripBaseline(value, domain, config)
+	}
+
+	if len(queries) > 0 {
+		selected, ok := selectValue(value, domain, queries)
+		if !ok {
+			selected = DictValue{Values: make(map[string]Value), Order: []string{}, config: config}
+		}
+		value = selected
+	}
+
+	var redacted []string
+	if config.NoSecrets {
+		value, redacted = redactSecrets(value, domain, config.DropSecrets)
+	}
+
+	return Conversion{Value: value, Redacted: redacted, Volatile: volatile}, nil
+}
+
@@ -0,0 +1,213 @@
+package plist
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SelectQuery is a parsed -select expression such as
+// "com.apple.dock:persistent-apps" or "NSGlobalDomain:Apple*".
+type SelectQuery struct {
+	Domain    string   // Domain pattern before ':', empty when not given
+	HasDomain bool     // Whether the query named a domain
+	Path      []string // Key path segments, each may contain '*' wildcards
+}
+
+// ParseSelectQuery parses a selection query. A ':' separates an optional
+// domain from the key path. Path segments are separated by '/' when the path
+// contains one, otherwise by '.', so keys containing dots can still be
+// addressed as "domain:some.key/child".
+func ParseSelectQuery(query string) SelectQuery {
+	var q SelectQuery
+	path := query
+	if domain, rest, found := strings.Cut(query, ":"); found {
+		q.Domain = domain
+		q.HasDomain = true
+		path = rest
+	}
+
+	q.Path = parseKeyPath(path)
+	return q
+}
+
+// parseKeyPath splits a key path written by FormatKeyPath into segments.
+func parseKeyPath(path string) []string {
+	sep := "."
+	if strings.Contains(path, "/") {
+		sep = "/"
+	}
+	var segments []string
+	for _, segment := range strings.Split(path, sep) {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// segmentsFor returns the key path of the query relative to the value read
+// for domain. An empty domain means the value is keyed by domain, as with
+// `defaults read` for all domains. ok is false when the query names another
+// domain.
+func (q SelectQuery) segmentsFor(domain string) (segments []string, ok bool) {
+	if !q.HasDomain {
+		return q.Path, true
+	}
+	if domain == "" {
+		return append([]string{q.Domain}, q.Path...), true
+	}
+	if !matchWildcard(q.Domain, domain) {
+		return nil, false
+	}
+	return q.Path, true
+}
+
+// selectValue keeps only the parts of value matched by the queries,
+// preserving the structure from the root down to each match. It reports
+// false when nothing matched.
+func selectValue(value Value, domain string, queries []SelectQuery) (Value, bool) {
+	var paths [][]string
+	for _, q := range queries {
+		if segments, ok := q.segmentsFor(domain); ok {
+			paths = append(paths, segments)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, false
+	}
+	return selectPaths(value, paths, matchWildcard)
+}
+
+// SelectPaths keeps only the parts of value at the given key paths, such as
+// those of the changes returned by Diff, preserving the structure from the
+// root down to each of them. Path segments are literal keys or array
+// indices. It reports false when none of the paths exists in value.
+func SelectPaths(value Value, paths [][]string) (Value, bool) {
+	return selectPaths(value, paths, func(segment, s string) bool { return segment == s })
+}
+
+// selectPaths keeps the parts of value at paths, comparing each path
+// segment with keys and array indices using match.
+func selectPaths(value Value, paths [][]string, match func(segment, s string) bool) (Value, bool) {
+	// A fully consumed path selects the whole subtree
+	for _, path := range paths {
+		if len(path) == 0 {
+			return value, true
+		}
+	}
+
+	switch v := value.(type) {
+	case CommentValue:
+		selected, ok := selectPaths(v.Value, paths, match)
+		if !ok {
+			return nil, false
+		}
+		return CommentValue{Value: selected, Comment: v.Comment}, true
+	case DictValue:
+		result := DictValue{Values: make(map[string]Value), Order: []string{}, config: v.config}
+		for _, key := range DictKeys(v) {
+			child, exists := v.Values[key]
+			if !exists {
+				continue
+			}
+			name := UnquoteKey(key)
+			var rest [][]string
+			for _, path := range paths {
+				if match(path[0], name) {
+					rest = append(rest, path[1:])
+				}
+			}
+			if len(rest) == 0 {
+				continue
+			}
+			if selected, ok := selectPaths(child, rest, match); ok {
+				result.Values[key] = selected
+				result.Order = append(result.Order, key)
+			}
+		}
+		return result, len(result.Order) > 0
+	case ArrayValue:
+		result := ArrayValue{Values: []Value{}, config: v.config}
+		for i, child := range v.Values {
+			index := strconv.Itoa(i)
+			var rest [][]string
+			for _, path := range paths {
+				if match(path[0], index) {
+					rest = append(rest, path[1:])
+				}
+			}
+			if len(rest) == 0 {
+				continue
+			}
+			if selected, ok := selectPaths(child, rest, match); ok {
+				result.Values = append(result.Values, selected)
+			}
+		}
+		return result, len(result.Values) > 0
+	default:
+		return nil, false
+	}
+}
+
+// FormatKeyPath renders path segments in the syntax accepted by -select.
+func FormatKeyPath(path []string) string {
+	for _, segment := range path {
+		if strings.Contains(segment, ".") {
+			return strings.Join(path, "/")
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+// FormatDomainPath renders a key path as "domain:path". An empty domain means
+// the first segment of path is the domain, as with `defaults read` for all
+// domains.
+func FormatDomainPath(domain string, path []string) string {
+	if domain == "" && len(path) > 0 {
+		domain, path = path[0], path[1:]
+	}
+	return domain + ":" + FormatKeyPath(path)
+}
+
+// DictKeys returns the keys of d in their preserved order.
+func DictKeys(d DictValue) []string {
+	if len(d.Order) > 0 {
+		return d.Order
+	}
+	keys := make([]string, 0, len(d.Values))
+	for k := range d.Values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// UnquoteKey returns a dictionary key without the surrounding quotes that
+// `defaults read` uses for keys containing special characters.
+func UnquoteKey(key string) string {
+	if len(key) >= 2 && strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
+		return strings.ReplaceAll(key[1:len(key)-1], "\\\"", "\"")
+	}
+	return key
+}
+
+// matchWildcard reports whether s matches pattern, where '*' matches any
+// run of characters. No other characters are special, since defaults keys
+// regularly contain brackets and backslashes.
+func matchWildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
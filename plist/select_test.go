@@ -0,0 +1,217 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelectQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		domain    string
+		hasDomain bool
+		path      []string
+	}{
+		{"Domain and key", "com.apple.dock:persistent-apps", "com.apple.dock", true, []string{"persistent-apps"}},
+		{"Domain with wildcard key", "NSGlobalDomain:Apple*", "NSGlobalDomain", true, []string{"Apple*"}},
+		{"Dotted path", "com.apple.dock:persistent-apps.0.tile-data", "com.apple.dock", true, []string{"persistent-apps", "0", "tile-data"}},
+		{"Slash path keeps dots", "com.apple.Safari:com.apple.Safari.ContentPageGroupIdentifier/WebKit", "com.apple.Safari", true, []string{"com.apple.Safari.ContentPageGroupIdentifier", "WebKit"}},
+		{"Path only", "autohide", "", false, []string{"autohide"}},
+		{"Domain only", "com.apple.dock:", "com.apple.dock", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := ParseSelectQuery(tt.query)
+			if q.Domain != tt.domain || q.HasDomain != tt.hasDomain {
+				t.Errorf("parseSelectQuery(%q) domain = %q (%v), want %q (%v)", tt.query, q.Domain, q.HasDomain, tt.domain, tt.hasDomain)
+			}
+			if strings.Join(q.Path, "|") != strings.Join(tt.path, "|") {
+				t.Errorf("parseSelectQuery(%q) path = %q, want %q", tt.query, q.Path, tt.path)
+			}
+		})
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"autohide", "autohide", true},
+		{"autohide", "autohide-delay", false},
+		{"Apple*", "AppleInterfaceStyle", true},
+		{"Apple*", "NSAppleThing", false},
+		{"*Style", "AppleInterfaceStyle", true},
+		{"*Interface*", "AppleInterfaceStyle", true},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"*", "", true},
+		{"NSWindow Frame [x]", "NSWindow Frame [x]", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.s, func(t *testing.T) {
+			if result := matchWildcard(tt.pattern, tt.s); result != tt.expected {
+				t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.s, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelectValue(t *testing.T) {
+	dockInput := `{
+    autohide = 1;
+    "autohide-delay" = "0.2";
+    "persistent-apps" = (
+        {
+            "tile-data" = {
+                "file-label" = Safari;
+            };
+        },
+        {
+            "tile-data" = {
+                "file-label" = Mail;
+            };
+        }
+    );
+    tilesize = 48;
+}`
+
+	allInput := `{
+    "com.apple.dock" = {
+        autohide = 1;
+        tilesize = 48;
+    };
+    NSGlobalDomain = {
+        AppleInterfaceStyle = Dark;
+        AppleShowAllExtensions = 1;
+        NSAutomaticSpellingCorrectionEnabled = 0;
+    };
+}`
+
+	tests := []struct {
+		name     string
+		input    string
+		domain   string
+		queries  []string
+		expected string
+	}{
+		{
+			"Single key",
+			dockInput, "com.apple.dock",
+			[]string{"com.apple.dock:autohide"},
+			"{\n  autohide = true;\n}",
+		},
+		{
+			"Key without domain",
+			dockInput, "com.apple.dock",
+			[]string{"tilesize"},
+			"{\n  tilesize = 48;\n}",
+		},
+		{
+			"Wildcard keys keep order",
+			dockInput, "com.apple.dock",
+			[]string{"autohide*"},
+			"{\n  autohide = true;\n  \"autohide-delay\" = 0.2;\n}",
+		},
+		{
+			"Array index keeps structure",
+			dockInput, "com.apple.dock",
+			[]string{"com.apple.dock:persistent-apps.1.tile-data.file-label"},
+			"{\n  \"persistent-apps\" = [\n    {\n      \"tile-data\" = {\n        \"file-label\" = \"Mail\";\n      };\n    }\n  ];\n}",
+		},
+		{
+			"Multiple queries are merged",
+			dockInput, "com.apple.dock",
+			[]string{"tilesize", "autohide"},
+			"{\n  autohide = true;\n  tilesize = 48;\n}",
+		},
+		{
+			"Other domain matches nothing",
+			dockInput, "com.apple.dock",
+			[]string{"com.apple.finder:autohide"},
+			"{}",
+		},
+		{
+			"All domains keyed by domain",
+			allInput, "",
+			[]string{"NSGlobalDomain:Apple*", "com.apple.dock:autohide"},
+			"{\n  \"com.apple.dock\" = {\n    autohide = true;\n  };\n  NSGlobalDomain = {\n    AppleInterfaceStyle = \"Dark\";\n    AppleShowAllExtensions = true;\n  };\n}",
+		},
+		{
+			"Wildcard domain",
+			allInput, "",
+			[]string{"*:tilesize"},
+			"{\n  \"com.apple.dock\" = {\n    tilesize = 48;\n  };\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []SelectQuery
+			for _, q := range tt.queries {
+				queries = append(queries, ParseSelectQuery(q))
+			}
+			converted, err := ConvertDomain(strings.NewReader(tt.input), tt.domain, Options{}, queries)
+			if err != nil {
+				t.Fatalf("convertDomain() error = %v", err)
+			}
+			if result := converted.Value.ToNix(0); result != tt.expected {
+				t.Errorf("convertDomain() with %q =\n%s\nwant\n%s", tt.queries, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelectValue_WithFilters(t *testing.T) {
+	input := `{
+    "NSWindow Frame Main" = "0 0 800 600 0 0 1440 900 ";
+    NSDocumentSaveNewDocumentsToCloud = 0;
+}`
+
+	queries := []SelectQuery{ParseSelectQuery("NS*")}
+	converted, err := ConvertDomain(strings.NewReader(input), "NSGlobalDomain", Options{NoState: true}, queries)
+	if err != nil {
+		t.Fatalf("convertDomain() error = %v", err)
+	}
+
+	result := converted.Value.ToNix(0)
+	if strings.Contains(result, "NSWindow Frame") {
+		t.Error("Expected state filter to apply to selected keys")
+	}
+	if !strings.Contains(result, "NSDocumentSaveNewDocumentsToCloud = false") {
+		t.Errorf("Expected selected key to be kept, got: %s", result)
+	}
+}
+
+func TestSelectPaths_Literal(t *testing.T) {
+	input := `{
+    "Column*" = 1;
+    ColumnWidth = 200;
+    Columns = (
+        a,
+        b
+    );
+}`
+	value, err := Parse(strings.NewReader(input), "com.example.app", Options{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// Paths from Diff name real keys, so '*' is not a wildcard
+	selected, ok := SelectPaths(value, [][]string{{"Column*"}, {"Columns", "1"}})
+	if !ok {
+		t.Fatal("SelectPaths() selected nothing")
+	}
+	expected := "{\n  \"Column*\" = true;\n  Columns = [\n    \"b\"\n  ];\n}"
+	if result := selected.ToNix(0); result != expected {
+		t.Errorf("SelectPaths() =\n%s\nwant\n%s", result, expected)
+	}
+
+	if _, ok := SelectPaths(value, [][]string{{"Col*"}}); ok {
+		t.Error("Expected SelectPaths() not to match a wildcard")
+	}
+}
@@ -0,0 +1,248 @@
+package plist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A DefaultsSource reads the user defaults of a Mac. Its methods return
+// what the matching `defaults` command prints, so that the output can be
+// given to Parse.
+type DefaultsSource interface {
+	// Domains lists the domains, as `defaults domains` does.
+	Domains(ctx context.Context) ([]string, error)
+	// Read returns the defaults of domain, or of all domains keyed by
+	// domain when domain is empty.
+	Read(ctx context.Context, domain string) ([]byte, error)
+	// ReadKey returns the value of a single key of domain.
+	ReadKey(ctx context.Context, domain, key string) ([]byte, error)
+	// ReadType returns the type of a key of domain, such as "string",
+	// "integer" or "dictionary".
+	ReadType(ctx context.Context, domain, key string) (string, error)
+}
+
+// CommandSource reads defaults by running the defaults command, so it only
+// works on macOS.
+type CommandSource struct{}
+
+func (CommandSource) Domains(ctx context.Context) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "defaults", "domains").Output()
+	if err != nil {
+		return nil, err
+	}
+	var domains []string
+	for _, domain := range strings.Split(string(output), ", ") {
+		domain = strings.TrimSpace(domain)
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+func (CommandSource) Read(ctx context.Context, domain string) ([]byte, error) {
+	args := []string{"read"}
+	if domain != "" {
+		args = append(args, domain)
+	}
+	return exec.CommandContext(ctx, "defaults", args...).Output()
+}
+
+func (CommandSource) ReadKey(ctx context.Context, domain, key string) ([]byte, error) {
+	return exec.CommandContext(ctx, "defaults", "read", domain, key).Output()
+}
+
+func (CommandSource) ReadType(ctx context.Context, domain, key string) (string, error) {
+	output, err := exec.CommandContext(ctx, "defaults", "read-type", domain, key).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(output)), "Type is "), nil
+}
+
+// DirSource reads defaults from a directory holding the output of
+// `defaults read <domain>` for each domain in a file called <domain>.txt,
+// for example saved on another Mac.
+type DirSource struct {
+	Dir string
+}
+
+func (s DirSource) Domains(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var domains []string
+	for _, entry := range entries {
+		if domain, ok := strings.CutSuffix(entry.Name(), ".txt"); ok && !entry.IsDir() {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+func (s DirSource) Read(ctx context.Context, domain string) ([]byte, error) {
+	if domain == "" {
+		return readAllDomains(ctx, s)
+	}
+	// Domains name a file in Dir, never a path leading out of it
+	if !filepath.IsLocal(domain) || strings.ContainsAny(domain, `/\`) {
+		return nil, fmt.Errorf("Domain %s is not a valid domain name", domain)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, domain+".txt"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Domain %s does not exist", domain)
+	}
+	return data, err
+}
+
+func (s DirSource) ReadKey(ctx context.Context, domain, key string) ([]byte, error) {
+	return readKey(ctx, s, domain, key)
+}
+
+func (s DirSource) ReadType(ctx context.Context, domain, key string) (string, error) {
+	return readType(ctx, s, domain, key)
+}
+
+// MemorySource serves defaults held in memory, mapping each domain to the
+// output of `defaults read <domain>`. It stands in for a Mac in tests.
+type MemorySource map[string]string
+
+func (s MemorySource) Domains(ctx context.Context) ([]string, error) {
+	domains := make([]string, 0, len(s))
+	for domain := range s {
+		domains = append(domains, domain)
+	}
+	slices.Sort(domains)
+	return domains, nil
+}
+
+func (s MemorySource) Read(ctx context.Context, domain string) ([]byte, error) {
+	if domain == "" {
+		return readAllDomains(ctx, s)
+	}
+	output, ok := s[domain]
+	if !ok {
+		return nil, fmt.Errorf("Domain %s does not exist", domain)
+	}
+	return []byte(output), nil
+}
+
+func (s MemorySource) ReadKey(ctx context.Context, domain, key string) ([]byte, error) {
+	return readKey(ctx, s, domain, key)
+}
+
+func (s MemorySource) ReadType(ctx context.Context, domain, key string) (string, error) {
+	return readType(ctx, s, domain, key)
+}
+
+// plainDefaultsKey matches the keys `defaults read` prints without quotes.
+var plainDefaultsKey = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// readAllDomains joins the defaults of every domain of source into a
+// single dictionary, the way `defaults read` prints all domains.
+func readAllDomains(ctx context.Context, source DefaultsSource) ([]byte, error) {
+	domains, err := source.Domains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([][]byte, len(domains))
+	for i, domain := range domains {
+		if outputs[i], err = source.Read(ctx, domain); err != nil {
+			return nil, err
+		}
+	}
+	return JoinDomains(domains, outputs), nil
+}
+
+// JoinDomains joins the output of `defaults read <domain>` for each of
+// domains, given in the same order in outputs, into a single dictionary
+// keyed by domain, the way `defaults read` prints all domains.
+func JoinDomains(domains []string, outputs [][]byte) []byte {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for i, domain := range domains {
+		key := domain
+		if !plainDefaultsKey.MatchString(key) {
+			key = strconv.Quote(key)
+		}
+		fmt.Fprintf(&sb, "    %s = %s;\n", key, strings.TrimSpace(string(outputs[i])))
+	}
+	sb.WriteString("}\n")
+	return []byte(sb.String())
+}
+
+// rawValue returns the unparsed text of the value of key in the defaults
+// of domain.
+func rawValue(ctx context.Context, source DefaultsSource, domain, key string) (string, error) {
+	output, err := source.Read(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(string(output))
+	if strings.HasPrefix(content, "{") && strings.HasSuffix(content, "}") {
+		for _, entry := range dictEntries(strings.TrimSpace(content[1 : len(content)-1])) {
+			if UnquoteKey(entry.key) == key {
+				return entry.value, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("The domain/default pair of (%s, %s) does not exist", domain, key)
+}
+
+// readKey implements ReadKey on top of Read. Like `defaults read`, strings
+// are printed without their quotes.
+func readKey(ctx context.Context, source DefaultsSource, domain, key string) ([]byte, error) {
+	raw, err := rawValue(ctx, source, domain, key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(unquoteDefaultsString(raw) + "\n"), nil
+}
+
+// readType implements ReadType on top of Read. The type is guessed from
+// the text of the value, so booleans are reported as integers.
+func readType(ctx context.Context, source DefaultsSource, domain, key string) (string, error) {
+	raw, err := rawValue(ctx, source, domain, key)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(raw, "("):
+		return "array", nil
+	case strings.HasPrefix(raw, "{") && isBinaryDataValue(raw):
+		return "data", nil
+	case strings.HasPrefix(raw, "{"):
+		return "dictionary", nil
+	}
+	s := unquoteDefaultsString(raw)
+	if _, err := strconv.Atoi(s); err == nil {
+		return "integer", nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return "float", nil
+	}
+	if isDateString(s) {
+		return "date", nil
+	}
+	return "string", nil
+}
+
+// unquoteDefaultsString returns the contents of a quoted string printed by
+// `defaults read`, or raw when it isn't quoted.
+func unquoteDefaultsString(raw string) string {
+	if len(raw) < 2 || !strings.HasPrefix(raw, "\"") || !strings.HasSuffix(raw, "\"") {
+		return raw
+	}
+	s := raw[1 : len(raw)-1]
+	s = strings.ReplaceAll(s, "\\\"", "\"")
+	s = strings.ReplaceAll(s, "\\\\", "\\")
+	return s
+}
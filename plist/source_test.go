@@ -0,0 +1,140 @@
+package plist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var sourceDomains = map[string]string{
+	"com.apple.dock": `{
+    autohide = 1;
+    "autohide-delay" = "0.2";
+    "persistent-apps" = (
+        "Safari.app"
+    );
+    mineffect = genie;
+    "wvous-tl-corner" = 5;
+}`,
+	"NSGlobalDomain": `{
+    AppleLocale = "en_US";
+    "com.apple.sound.beep.sound" = "/System/Library/Sounds/Tink.aiff";
+}`,
+}
+
+func TestMemorySource(t *testing.T) {
+	testDefaultsSource(t, MemorySource(sourceDomains))
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	for domain, output := range sourceDomains {
+		if err := os.WriteFile(filepath.Join(dir, domain+".txt"), []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files without the .txt extension are not domains
+	if err := os.WriteFile(filepath.Join(dir, "baseline.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testDefaultsSource(t, DirSource{Dir: dir})
+
+	// Domains can't reach files outside the directory
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte(sourceDomains["com.apple.dock"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nested := DirSource{Dir: filepath.Join(dir, "dump")}
+	if err := os.Mkdir(nested.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, domain := range []string{"../secret", "dump/../../secret", filepath.Join(dir, "secret"), ".."} {
+		if _, err := nested.Read(context.Background(), domain); err == nil || !strings.Contains(err.Error(), "not a valid domain name") {
+			t.Errorf("Read(%q) error = %v, want an invalid domain error", domain, err)
+		}
+	}
+}
+
+func testDefaultsSource(t *testing.T, source DefaultsSource) {
+	ctx := context.Background()
+
+	domains, err := source.Domains(ctx)
+	if err != nil {
+		t.Fatalf("Domains() error = %v", err)
+	}
+	if strings.Join(domains, ",") != "NSGlobalDomain,com.apple.dock" {
+		t.Errorf("Domains() = %v, want [NSGlobalDomain com.apple.dock]", domains)
+	}
+
+	output, err := source.Read(ctx, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(output) != sourceDomains["com.apple.dock"] {
+		t.Errorf("Read() = %s, want %s", output, sourceDomains["com.apple.dock"])
+	}
+	if _, err := source.Read(ctx, "com.example.missing"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Read() of a missing domain error = %v", err)
+	}
+
+	output, err = source.Read(ctx, "")
+	if err != nil {
+		t.Fatalf("Read() of all domains error = %v", err)
+	}
+	value, err := Parse(strings.NewReader(string(output)), "", Options{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if keys := DictKeys(value.(DictValue)); strings.Join(keys, ",") != `NSGlobalDomain,"com.apple.dock"` {
+		t.Errorf("Read() of all domains has domains %v", keys)
+	}
+
+	keys := []struct {
+		domain, key string
+		value       string
+		kind        string
+	}{
+		{"com.apple.dock", "autohide", "1\n", "integer"},
+		{"com.apple.dock", "autohide-delay", "0.2\n", "float"},
+		{"com.apple.dock", "mineffect", "genie\n", "string"},
+		{"com.apple.dock", "persistent-apps", "(\n        \"Safari.app\"\n    )\n", "array"},
+		{"NSGlobalDomain", "com.apple.sound.beep.sound", "/System/Library/Sounds/Tink.aiff\n", "string"},
+	}
+	for _, tt := range keys {
+		value, err := source.ReadKey(ctx, tt.domain, tt.key)
+		if err != nil {
+			t.Errorf("ReadKey(%s, %s) error = %v", tt.domain, tt.key, err)
+		} else if string(value) != tt.value {
+			t.Errorf("ReadKey(%s, %s) = %q, want %q", tt.domain, tt.key, value, tt.value)
+		}
+		kind, err := source.ReadType(ctx, tt.domain, tt.key)
+		if err != nil {
+			t.Errorf("ReadType(%s, %s) error = %v", tt.domain, tt.key, err)
+		} else if kind != tt.kind {
+			t.Errorf("ReadType(%s, %s) = %s, want %s", tt.domain, tt.key, kind, tt.kind)
+		}
+	}
+	if _, err := source.ReadKey(ctx, "com.apple.dock", "tilesize"); err == nil {
+		t.Error("Expected ReadKey() of a missing key to fail")
+	}
+}
+
+func TestJoinDomains(t *testing.T) {
+	output := JoinDomains([]string{"com.apple.dock", "NSGlobalDomain"}, [][]byte{
+		[]byte(sourceDomains["com.apple.dock"]),
+		[]byte(sourceDomains["NSGlobalDomain"] + "\n"),
+	})
+	value, err := Parse(strings.NewReader(string(output)), "", Options{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	dict := value.(DictValue)
+	if keys := DictKeys(dict); strings.Join(keys, ",") != `"com.apple.dock",NSGlobalDomain` {
+		t.Errorf("JoinDomains() has domains %v, want them in the order given", keys)
+	}
+	dock, ok := dict.Values[`"com.apple.dock"`].(DictValue)
+	if !ok || len(dock.Values) != 5 {
+		t.Errorf("JoinDomains() lost the keys of com.apple.dock: %#v", dict.Values[`"com.apple.dock"`])
+	}
+}
@@ -0,0 +1,86 @@
+package plist
+
+import "slices"
+
+// volatileComment annotates keys whose value changed between samples.
+const volatileComment = "volatile: changed between samples"
+
+// markVolatile compares samples of the same defaults, oldest first, and
+// returns the latest sample with every key whose value changed between
+// samples annotated with a comment, or dropped when drop is set. Arrays are
+// compared as a whole, since their indexes are not stable. It also returns
+// the key paths of the volatile keys.
+func markVolatile(samples []Value, drop bool) (Value, [][]string) {
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	var volatile [][]string
+	report := func(path []string) {
+		volatile = append(volatile, path)
+	}
+
+	latest := samples[len(samples)-1]
+	if !allDicts(samples) {
+		return latest, nil
+	}
+	return markVolatileDict(samples, nil, drop, report), volatile
+}
+
+func markVolatileDict(samples []Value, path []string, drop bool, report func([]string)) DictValue {
+	latest := samples[len(samples)-1].(DictValue)
+	result := DictValue{Values: make(map[string]Value), Order: latest.Order, config: latest.config}
+
+	for _, key := range DictKeys(latest) {
+		child, exists := latest.Values[key]
+		if !exists {
+			continue
+		}
+		childPath := append(slices.Clone(path), UnquoteKey(key))
+
+		children := make([]Value, 0, len(samples))
+		present := true
+		for _, sample := range samples {
+			c, ok := sample.(DictValue).Values[key]
+			if !ok {
+				present = false
+				break
+			}
+			children = append(children, c)
+		}
+
+		switch {
+		case present && allDicts(children):
+			result.Values[key] = markVolatileDict(children, childPath, drop, report)
+		case present && allEqual(children):
+			result.Values[key] = child
+		default:
+			report(childPath)
+			if drop {
+				result.Values[key] = SkipValue{}
+			} else {
+				result.Values[key] = CommentValue{Value: child, Comment: volatileComment}
+			}
+		}
+	}
+
+	return result
+}
+
+func allDicts(values []Value) bool {
+	for _, v := range values {
+		if _, ok := v.(DictValue); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func allEqual(values []Value) bool {
+	for _, v := range values[1:] {
+		if !compareValues(values[0], v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+)
+
+// Snapshots of `defaults read com.apple.dock` taken a few seconds apart
+var dockSnapshots = []string{
+	`{
+    autohide = 1;
+    "last-messagetrace-stamp" = "740000000.1";
+    tilesize = 48;
+    "workspace-state" = {
+        lastSpace = 1;
+        showRecents = 0;
+    };
+}`,
+	`{
+    autohide = 1;
+    "last-messagetrace-stamp" = "740000012.7";
+    tilesize = 48;
+    "workspace-state" = {
+        lastSpace = 3;
+        showRecents = 0;
+    };
+}`,
+	`{
+    autohide = 1;
+    "last-messagetrace-stamp" = "740000025.3";
+    tilesize = 48;
+    "workspace-state" = {
+        lastSpace = 3;
+        showRecents = 0;
+    };
+    wvous-tl-corner = 2;
+}`,
+}
+
+func dockSamples() [][]byte {
+	var samples [][]byte
+	for _, s := range dockSnapshots {
+		samples = append(samples, []byte(s))
+	}
+	return samples
+}
+
+func TestMarkVolatile(t *testing.T) {
+	var values []Value
+	for _, s := range dockSnapshots {
+		values = append(values, parseValue(s))
+	}
+
+	_, paths := markVolatile(values, false)
+
+	var got []string
+	for _, path := range paths {
+		got = append(got, FormatKeyPath(path))
+	}
+	expected := []string{"last-messagetrace-stamp", "workspace-state.lastSpace", "wvous-tl-corner"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("markVolatile() paths = %v, want %v", got, expected)
+	}
+}
+
+func TestMarkVolatile_SingleSample(t *testing.T) {
+	value := parseValue(dockSnapshots[0])
+	result, paths := markVolatile([]Value{value}, false)
+	if len(paths) != 0 {
+		t.Errorf("Expected no volatile keys from a single sample, got %v", paths)
+	}
+	if result.ToNix(0) != value.ToNix(0) {
+		t.Errorf("Expected single sample to be unchanged, got:\n%s", result.ToNix(0))
+	}
+}
+
+func TestMarkVolatile_Arrays(t *testing.T) {
+	values := []Value{
+		parseValue(`{ apps = (Safari, Mail); fixed = (a, b); }`),
+		parseValue(`{ apps = (Mail, Safari); fixed = (a, b); }`),
+	}
+
+	_, paths := markVolatile(values, false)
+	if len(paths) != 1 || FormatKeyPath(paths[0]) != "apps" {
+		t.Errorf("Expected reordered array to be volatile as a whole, got %v", paths)
+	}
+}
+
+func TestVolatileSampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		drop        bool
+		contains    []string
+		notContains []string
+	}{
+		{
+			"Annotate",
+			false,
+			[]string{
+				"autohide = true;",
+				"\"last-messagetrace-stamp\" = 740000025.3; # volatile: changed between samples",
+				"lastSpace = 3; # volatile: changed between samples",
+				"showRecents = false;",
+				"\"wvous-tl-corner\" = 2; # volatile: changed between samples",
+			},
+			nil,
+		},
+		{
+			"Drop",
+			true,
+			[]string{"autohide = true;", "tilesize = 48;", "showRecents = false;"},
+			[]string{"last-messagetrace-stamp", "lastSpace", "wvous-tl-corner", "volatile"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Options{DropVolatile: tt.drop}
+			converted, err := ConvertSamples(dockSamples(), "com.apple.dock", config, nil)
+			if err != nil {
+				t.Fatalf("convertSamples() error = %v", err)
+			}
+
+			expected := []string{
+				"com.apple.dock:last-messagetrace-stamp",
+				"com.apple.dock:workspace-state.lastSpace",
+				"com.apple.dock:wvous-tl-corner",
+			}
+			if strings.Join(converted.Volatile, ",") != strings.Join(expected, ",") {
+				t.Errorf("Volatile = %v, want %v", converted.Volatile, expected)
+			}
+
+			result := converted.Value.ToNix(0)
+			for _, s := range tt.contains {
+				if !strings.Contains(result, s) {
+					t.Errorf("Expected output to contain %q, got:\n%s", s, result)
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(result, s) {
+					t.Errorf("Expected output not to contain %q, got:\n%s", s, result)
+				}
+			}
+		})
+	}
+}
+
+func TestVolatileSampling_AllDomains(t *testing.T) {
+	samples := [][]byte{
+		[]byte(`{ "com.apple.dock" = { autohide = 1; lastSpace = 1; }; }`),
+		[]byte(`{ "com.apple.dock" = { autohide = 1; lastSpace = 2; }; }`),
+	}
+
+	converted, err := ConvertSamples(samples, "", Options{}, nil)
+	if err != nil {
+		t.Fatalf("convertSamples() error = %v", err)
+	}
+	if len(converted.Volatile) != 1 || converted.Volatile[0] != "com.apple.dock:lastSpace" {
+		t.Errorf("Expected volatile path keyed by domain, got %v", converted.Volatile)
+	}
+}
+
+func TestVolatileSampling_WithSelect(t *testing.T) {
+	queries := []SelectQuery{ParseSelectQuery("workspace-state")}
+	converted, err := ConvertSamples(dockSamples(), "com.apple.dock", Options{}, queries)
+	if err != nil {
+		t.Fatalf("convertSamples() error = %v", err)
+	}
+
+	result := converted.Value.ToNix(0)
+	if !strings.Contains(result, "lastSpace = 3; # volatile: changed between samples") {
+		t.Errorf("Expected selected volatile key to stay annotated, got:\n%s", result)
+	}
+	if strings.Contains(result, "tilesize") {
+		t.Errorf("Expected unselected keys to be removed, got:\n%s", result)
+	}
+}
@@ -7,7 +7,7 @@ nix flake update
 VERSION=$(cat version.txt)
 TMP_BIN=$(mktemp)
 trap 'rm -f "$TMP_BIN"' EXIT
-go mod tidy && go build -o "$TMP_BIN"
+go mod tidy && go build -ldflags "-X main.version=$VERSION" -o "$TMP_BIN" ./cmd/defaults2nix
 BIN_HASH=$(nix hash file "$TMP_BIN")
 jq -n \
   --arg bin_hash "$BIN_HASH" \